@@ -1,13 +1,20 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"time"
+	_ "time/tzdata" // Streak days need IANA zones even on images without them
 
+	"github.com/FieldPs/escape-room-backend/internal/auth"
+	"github.com/FieldPs/escape-room-backend/internal/export"
+	"github.com/FieldPs/escape-room-backend/internal/mail"
+	"github.com/FieldPs/escape-room-backend/internal/room"
 	"github.com/FieldPs/escape-room-backend/internal/routes"
+	"github.com/FieldPs/escape-room-backend/internal/tokens"
 	"github.com/FieldPs/escape-room-backend/migrations"
 	"github.com/gin-contrib/cors"
 
@@ -23,6 +30,17 @@ func main() {
 		fmt.Println("Warning: Could not load .env file")
 	}
 
+	// Refuse to start without a key to sign tokens with
+	if err := auth.LoadKeys(); err != nil {
+		log.Fatal("JWT keys: ", err)
+	}
+
+	// A misconfigured mailer would silently lose verification and reset links
+	mailer, err := mail.FromEnv()
+	if err != nil {
+		log.Fatal("Mail: ", err)
+	}
+
 	// Construct PostgreSQL DSN
 	dsn := fmt.Sprintf(
 		"host=%s user=%s password=%s dbname=%s port=%s",
@@ -46,6 +64,12 @@ func main() {
 		log.Fatal("Migration failed:", err)
 	}
 
+	// 2. Let the server, not the client, decide when room sessions run out
+	go room.RunSweeper(context.Background(), db, 30*time.Second)
+	go room.RunTicker(context.Background(), db, 5*time.Second)
+	go tokens.RunPurger(context.Background(), db, time.Hour)
+	go export.RunPurger(context.Background(), db, time.Hour)
+
 	// Set up Gin router
 	r := gin.Default()
 
@@ -61,7 +85,7 @@ func main() {
 	r.OPTIONS("/*any", func(c *gin.Context) {
 		c.Status(http.StatusOK)
 	})
-	routes.SetupRoutes(r, db)
+	routes.SetupRoutes(r, db, mailer)
 
 	// Run server
 	port := os.Getenv("APP_PORT")
@@ -0,0 +1,325 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/FieldPs/escape-room-backend/internal/auth"
+	mailer "github.com/FieldPs/escape-room-backend/internal/mail"
+	"github.com/FieldPs/escape-room-backend/internal/models"
+	"github.com/FieldPs/escape-room-backend/internal/tokens"
+	"github.com/FieldPs/escape-room-backend/internal/validation"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Audiences of the account action tokens
+const (
+	ActionVerifyEmail   = "verify_email"
+	ActionResetPassword = "reset_password"
+)
+
+// How long the links in account emails keep working
+const (
+	VerifyEmailTTL   = 48 * time.Hour
+	ResetPasswordTTL = time.Hour
+)
+
+// MinPasswordLen matches the binding on registration
+const MinPasswordLen = 6
+
+// Username length limits
+const (
+	MinUsernameLen = 3
+	MaxUsernameLen = 32
+)
+
+// sendTimeout bounds mail delivery that runs after the response was sent
+const sendTimeout = 30 * time.Second
+
+var (
+	ErrUserNotFound    = errors.New("user not found")
+	ErrEmailTaken      = errors.New("email already in use")
+	ErrNoEmail         = errors.New("no email address on this account")
+	ErrAlreadyVerified = errors.New("email address is already verified")
+)
+
+// EmailView is the caller's address and whether it was verified
+type EmailView struct {
+	Email      *string    `json:"email"`
+	Verified   bool       `json:"verified"`
+	VerifiedAt *time.Time `json:"verified_at"`
+}
+
+// ValidateEmail checks a bare address and returns it lowercased
+func ValidateEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "", &validation.Error{Field: "email", Message: "must be a valid email address"}
+	}
+	return email, nil
+}
+
+// ValidateUsername checks the new name on a rename and returns it trimmed.
+// Letters, digits, '_', '.' and '-' are allowed. Registration does not use it,
+// so accounts created with other names keep working.
+func ValidateUsername(username string) (string, error) {
+	username = strings.TrimSpace(username)
+	if n := len(username); n < MinUsernameLen || n > MaxUsernameLen {
+		return "", &validation.Error{Field: "username", Message: fmt.Sprintf("must be %d to %d characters", MinUsernameLen, MaxUsernameLen)}
+	}
+	for _, r := range username {
+		if !(r == '_' || r == '.' || r == '-' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')) {
+			return "", &validation.Error{Field: "username", Message: "may only contain letters, digits, '_', '.' and '-'"}
+		}
+	}
+	return username, nil
+}
+
+// ValidatePassword checks a new password
+func ValidatePassword(password string) error {
+	if len(password) < MinPasswordLen {
+		return &validation.Error{Field: "new_password", Message: fmt.Sprintf("must be at least %d characters", MinPasswordLen)}
+	}
+	return nil
+}
+
+// EmailInUse reports whether another account already has the address
+func EmailInUse(db *gorm.DB, email string, exceptUserID uint) (bool, error) {
+	var count int64
+	if err := db.Model(&models.User{}).
+		Where("email = ? AND id <> ?", email, exceptUserID).
+		Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to check email: %w", err)
+	}
+	return count > 0, nil
+}
+
+// SetEmail changes the user's address and sends a verification link to it.
+// The new address is unverified until the link is followed.
+func SetEmail(db *gorm.DB, m mailer.Mailer, userID uint, email string) (*EmailView, error) {
+	email, err := ValidateEmail(email)
+	if err != nil {
+		return nil, err
+	}
+	taken, err := EmailInUse(db, email, userID)
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, ErrEmailTaken
+	}
+
+	result := db.Model(&models.User{}).
+		Where("id = ?", userID).
+		Updates(map[string]interface{}{"email": email, "email_verified_at": nil})
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrDuplicatedKey) {
+			return nil, ErrEmailTaken
+		}
+		return nil, fmt.Errorf("failed to update email: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrUserNotFound
+	}
+
+	if err := SendVerification(db, m, userID, email); err != nil {
+		return nil, err
+	}
+	return &EmailView{Email: &email}, nil
+}
+
+// GetEmail returns the user's address and its verification state
+func GetEmail(db *gorm.DB, userID uint) (*EmailView, error) {
+	user, err := getUser(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &EmailView{
+		Email:      user.Email,
+		Verified:   user.EmailVerifiedAt != nil,
+		VerifiedAt: user.EmailVerifiedAt,
+	}, nil
+}
+
+// ResendVerification sends a fresh verification link; earlier links stop working
+func ResendVerification(db *gorm.DB, m mailer.Mailer, userID uint) error {
+	user, err := getUser(db, userID)
+	if err != nil {
+		return err
+	}
+	if user.Email == nil {
+		return ErrNoEmail
+	}
+	if user.EmailVerifiedAt != nil {
+		return ErrAlreadyVerified
+	}
+	return SendVerification(db, m, userID, *user.Email)
+}
+
+// SendVerification mails a link that verifies email for the user
+func SendVerification(db *gorm.DB, m mailer.Mailer, userID uint, email string) error {
+	token, err := tokens.IssueAction(db, userID, ActionVerifyEmail, email, VerifyEmailTTL)
+	if err != nil {
+		return err
+	}
+
+	msg := mailer.Message{
+		To:      email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Follow this link to verify your email address:\n\n%s\n\n"+
+			"The link works once and expires in %s. If you did not add this address, ignore this email.\n",
+			link("/verify-email", token), humanize(VerifyEmailTTL)),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+	return m.Send(ctx, msg)
+}
+
+// VerifyEmail marks the address in a verification token as verified. Links
+// for an address the user has since replaced are rejected.
+func VerifyEmail(db *gorm.DB, token string) (*EmailView, error) {
+	var view *EmailView
+	err := db.Transaction(func(tx *gorm.DB) error {
+		claims, err := tokens.ConsumeAction(tx, token, ActionVerifyEmail)
+		if err != nil {
+			return err
+		}
+
+		var user models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&user, claims.UserID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return tokens.ErrInvalidActionToken
+			}
+			return fmt.Errorf("failed to get user: %w", err)
+		}
+		if user.Email == nil || *user.Email != claims.Email {
+			return tokens.ErrInvalidActionToken
+		}
+
+		now := time.Now()
+		if user.EmailVerifiedAt == nil {
+			if err := tx.Model(&user).Update("email_verified_at", now).Error; err != nil {
+				return fmt.Errorf("failed to verify email: %w", err)
+			}
+			user.EmailVerifiedAt = &now
+		}
+		view = &EmailView{Email: user.Email, Verified: true, VerifiedAt: user.EmailVerifiedAt}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return view, nil
+}
+
+// RequestPasswordReset mails a reset link if email belongs to an account and
+// is verified. It never says whether it did, so callers cannot probe for
+// accounts, and delivery happens in the background for the same reason.
+func RequestPasswordReset(db *gorm.DB, m mailer.Mailer, email string) error {
+	email, err := ValidateEmail(email)
+	if err != nil {
+		return err
+	}
+
+	var user models.User
+	err = db.Where("email = ? AND email_verified_at IS NOT NULL", email).Limit(1).Find(&user).Error
+	if err != nil {
+		return fmt.Errorf("failed to find user: %w", err)
+	}
+	if user.ID == 0 {
+		return nil
+	}
+
+	token, err := tokens.IssueAction(db, user.ID, ActionResetPassword, email, ResetPasswordTTL)
+	if err != nil {
+		return err
+	}
+
+	msg := mailer.Message{
+		To:      email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nFollow this link to choose a new password:\n\n%s\n\n"+
+			"The link works once and expires in %s. If you did not ask for this, ignore this email; your password is unchanged.\n",
+			user.Username, link("/reset-password", token), humanize(ResetPasswordTTL)),
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+		defer cancel()
+		if err := m.Send(ctx, msg); err != nil {
+			log.Printf("Password reset mail for user %d: %v", user.ID, err)
+		}
+	}()
+	return nil
+}
+
+// ResetPassword sets a new password with a reset token and logs the user out
+// everywhere
+func ResetPassword(db *gorm.DB, token string, newPassword string) error {
+	if err := ValidatePassword(newPassword); err != nil {
+		return err
+	}
+	hash, err := auth.HashPassword(newPassword)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		claims, err := tokens.ConsumeAction(tx, token, ActionResetPassword)
+		if err != nil {
+			return err
+		}
+
+		// A link sent to an address the user has since replaced is stale
+		result := tx.Model(&models.User{}).
+			Where("id = ? AND email = ?", claims.UserID, claims.Email).
+			Update("password_hash", hash)
+		if result.Error != nil {
+			return fmt.Errorf("failed to update password: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return tokens.ErrInvalidActionToken
+		}
+		return tokens.RevokeUser(tx, uint(claims.UserID))
+	})
+}
+
+func getUser(db *gorm.DB, userID uint) (*models.User, error) {
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	return &user, nil
+}
+
+// link builds a frontend URL from APP_BASE_URL, read on every call so values
+// loaded from .env are picked up
+func link(path string, token string) string {
+	base := strings.TrimRight(os.Getenv("APP_BASE_URL"), "/")
+	if base == "" {
+		base = "http://localhost:3000"
+	}
+	return base + path + "?token=" + url.QueryEscape(token)
+}
+
+func humanize(d time.Duration) string {
+	if d%time.Hour == 0 {
+		if h := int(d / time.Hour); h != 1 {
+			return fmt.Sprintf("%d hours", h)
+		}
+		return "1 hour"
+	}
+	return d.String()
+}
@@ -0,0 +1,192 @@
+package account
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/FieldPs/escape-room-backend/internal/auth"
+	"github.com/FieldPs/escape-room-backend/internal/export"
+	"github.com/FieldPs/escape-room-backend/internal/models"
+	"github.com/FieldPs/escape-room-backend/internal/team"
+	"github.com/FieldPs/escape-room-backend/internal/tokens"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrWrongPassword = errors.New("password is incorrect")
+	ErrUsernameTaken = errors.New("username already taken")
+)
+
+// deletedWithUser are the tables whose rows DeleteAccount removes by user_id.
+// A new table with a user_id column must be added here, or handled in
+// DeleteAccount, on purpose. revoked_tokens is left out: revocations must
+// outlive the account so its access tokens stay denied until they expire.
+var deletedWithUser = []interface{}{
+	&models.UserPuzzle{},
+	&models.UserSolvedPuzzle{},
+	&models.Attempt{},
+	&models.PuzzleOpen{},
+	&models.UserHint{},
+	&models.RoomSession{},
+	&models.TeamMember{},
+	&models.TeamInvite{},
+	&models.UserAchievement{},
+	&models.ReviewCard{},
+	&models.Review{},
+	&models.RefreshToken{},
+	&models.ActionToken{},
+	&models.ExportJob{},
+}
+
+// ChangePassword replaces the password after checking the current one and
+// logs out every login, including the caller's. The caller gets a fresh token
+// pair so only this device stays signed in.
+func ChangePassword(db *gorm.DB, claims *auth.Claims, oldPassword string, newPassword string) (*tokens.Pair, error) {
+	userID := uint(claims.UserID)
+	if err := ValidatePassword(newPassword); err != nil {
+		return nil, err
+	}
+	hash, err := auth.HashPassword(newPassword)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := checkPassword(tx, userID, oldPassword); err != nil {
+			return err
+		}
+		if err := tx.Model(&models.User{}).
+			Where("id = ?", userID).
+			Update("password_hash", hash).Error; err != nil {
+			return fmt.Errorf("failed to update password: %w", err)
+		}
+		return tokens.LogoutAll(tx, userID, claims)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tokens.Issue(db, userID)
+}
+
+// ChangeUsername renames the account. Usernames are unique and must pass
+// ValidateUsername.
+func ChangeUsername(db *gorm.DB, userID uint, username string) (string, error) {
+	username, err := ValidateUsername(username)
+	if err != nil {
+		return "", err
+	}
+
+	var count int64
+	if err := db.Model(&models.User{}).
+		Where("username = ? AND id <> ?", username, userID).
+		Count(&count).Error; err != nil {
+		return "", fmt.Errorf("failed to check username: %w", err)
+	}
+	if count > 0 {
+		return "", ErrUsernameTaken
+	}
+
+	result := db.Model(&models.User{}).Where("id = ?", userID).Update("username", username)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrDuplicatedKey) {
+			return "", ErrUsernameTaken
+		}
+		return "", fmt.Errorf("failed to update username: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return "", ErrUserNotFound
+	}
+	return username, nil
+}
+
+// DeleteAccount removes the user and their rows in one transaction, after
+// checking the password. What the user did for a team stays with the team:
+// team sessions they started, their team solves and the attempts on those
+// puzzles are kept with user_id 0, and invites they sent keep invited_by 0.
+func DeleteAccount(db *gorm.DB, claims *auth.Claims, password string) error {
+	userID := uint(claims.UserID)
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := checkPassword(tx, userID, password); err != nil {
+			return err
+		}
+
+		// Deny the outstanding access tokens before their refresh rows go
+		if err := tokens.LogoutAll(tx, userID, claims); err != nil {
+			return err
+		}
+		if err := team.RemoveUser(tx, userID); err != nil {
+			return err
+		}
+		if err := anonymizeTeamRows(tx, userID); err != nil {
+			return err
+		}
+
+		for _, model := range deletedWithUser {
+			if err := tx.Where("user_id = ?", userID).Delete(model).Error; err != nil {
+				return fmt.Errorf("failed to delete user data: %w", err)
+			}
+		}
+
+		if err := tx.Delete(&models.User{}, userID).Error; err != nil {
+			return fmt.Errorf("failed to delete user: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// Export zips are files, not rows; the export purger removes any left behind
+	if err := export.RemoveUserFiles(userID); err != nil {
+		log.Printf("Deleting exports of user %d: %v", userID, err)
+	}
+	return nil
+}
+
+// anonymizeTeamRows detaches the user from rows that count for a team, so
+// teammates keep their room progress, scores and escape credit
+func anonymizeTeamRows(tx *gorm.DB, userID uint) error {
+	// Attempts have no team_id; keep those on puzzles the user solved for a team
+	teamSolved := tx.Model(&models.UserPuzzle{}).
+		Select("puzzle_id").
+		Where("user_id = ? AND team_id IS NOT NULL", userID)
+	if err := tx.Model(&models.Attempt{}).
+		Where("user_id = ? AND puzzle_id IN (?)", userID, teamSolved).
+		Update("user_id", 0).Error; err != nil {
+		return fmt.Errorf("failed to detach team attempts: %w", err)
+	}
+
+	for _, model := range []interface{}{&models.UserPuzzle{}, &models.RoomSession{}} {
+		if err := tx.Model(model).
+			Where("user_id = ? AND team_id IS NOT NULL", userID).
+			Update("user_id", 0).Error; err != nil {
+			return fmt.Errorf("failed to detach team rows: %w", err)
+		}
+	}
+
+	if err := tx.Model(&models.TeamInvite{}).
+		Where("invited_by = ?", userID).
+		Update("invited_by", 0).Error; err != nil {
+		return fmt.Errorf("failed to detach sent invites: %w", err)
+	}
+	return nil
+}
+
+// checkPassword locks the user row and compares the password with its hash
+func checkPassword(tx *gorm.DB, userID uint, password string) error {
+	var user models.User
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id", "password_hash").
+		First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUserNotFound
+		}
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if !auth.CheckPasswordHash(password, user.PasswordHash) {
+		return ErrWrongPassword
+	}
+	return nil
+}
@@ -0,0 +1,294 @@
+package achievements
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/FieldPs/escape-room-backend/internal/models"
+	"github.com/FieldPs/escape-room-backend/internal/team"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// What a rule counts. A badge unlocks once the count reaches its threshold.
+const (
+	KindSolves        = "solves"         // Puzzles solved
+	KindSubjectSolves = "subject_solves" // Puzzles solved that are tagged with the rule's subject
+	KindStreak        = "streak"         // Best daily streak
+	KindRoomsEscaped  = "rooms_escaped"  // Rooms escaped, solo or with the current team
+	KindFlawlessRooms = "flawless_rooms" // Escaped rooms in which the user unlocked none of the hints
+)
+
+var Kinds = []string{KindSolves, KindSubjectSolves, KindStreak, KindRoomsEscaped, KindFlawlessRooms}
+
+//go:embed rules.json
+var rulesJSON []byte
+
+// Rule declares a badge. Rules live in rules.json; add a badge by adding a rule.
+type Rule struct {
+	Code        string `json:"code"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Kind        string `json:"kind"`
+	Subject     string `json:"subject,omitempty"`
+	Threshold   int64  `json:"threshold"`
+}
+
+func (r Rule) validate() error {
+	if r.Code == "" || r.Title == "" {
+		return errors.New("code and title are required")
+	}
+	if !slices.Contains(Kinds, r.Kind) {
+		return fmt.Errorf("unknown kind %q", r.Kind)
+	}
+	if (r.Kind == KindSubjectSolves) != (r.Subject != "") {
+		return fmt.Errorf("subject is required for %s rules and only allowed there", KindSubjectSolves)
+	}
+	if r.Subject != "" && !slices.Contains(models.Subjects, r.Subject) {
+		return fmt.Errorf("unknown subject %q", r.Subject)
+	}
+	if r.Threshold < 1 {
+		return errors.New("threshold must be at least 1")
+	}
+	return nil
+}
+
+// Rules parses and checks the declared rules
+func Rules() ([]Rule, error) {
+	var rules []Rule
+	if err := json.Unmarshal(rulesJSON, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse achievement rules: %w", err)
+	}
+
+	seen := make(map[string]bool, len(rules))
+	for _, r := range rules {
+		if err := r.validate(); err != nil {
+			return nil, fmt.Errorf("achievement rule %q: %w", r.Code, err)
+		}
+		if seen[r.Code] {
+			return nil, fmt.Errorf("achievement rule %q is declared twice", r.Code)
+		}
+		seen[r.Code] = true
+	}
+	return rules, nil
+}
+
+// Sync upserts the declared rules into the achievements table. Rules removed
+// from the file stay in the table so badges already earned are kept.
+func Sync(db *gorm.DB) error {
+	rules, err := Rules()
+	if err != nil {
+		return err
+	}
+
+	for _, r := range rules {
+		if err := db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "code"}},
+			DoUpdates: clause.AssignmentColumns([]string{"title", "description", "kind", "subject", "threshold"}),
+		}).Create(&models.Achievement{
+			Code:        r.Code,
+			Title:       r.Title,
+			Description: r.Description,
+			Kind:        r.Kind,
+			Subject:     r.Subject,
+			Threshold:   r.Threshold,
+		}).Error; err != nil {
+			return fmt.Errorf("failed to sync achievement %q: %w", r.Code, err)
+		}
+	}
+	return nil
+}
+
+// Badge is an achievement as seen by one user
+type Badge struct {
+	Code        string     `json:"code"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Kind        string     `json:"kind"`
+	Subject     string     `json:"subject,omitempty"`
+	Threshold   int64      `json:"threshold"`
+	Progress    int64      `json:"progress"`    // Capped at the threshold
+	UnlockedAt  *time.Time `json:"unlocked_at"` // nil while locked
+}
+
+func newBadge(a models.Achievement, progress int64, unlockedAt *time.Time) Badge {
+	return Badge{
+		Code:        a.Code,
+		Title:       a.Title,
+		Description: a.Description,
+		Kind:        a.Kind,
+		Subject:     a.Subject,
+		Threshold:   a.Threshold,
+		Progress:    min(progress, a.Threshold),
+		UnlockedAt:  unlockedAt,
+	}
+}
+
+// Evaluate unlocks every badge whose rule the user now meets and returns the
+// newly unlocked ones. Call it inside the solve transaction so badges commit
+// together with the solve that earned them.
+func Evaluate(tx *gorm.DB, userID uint) ([]Badge, error) {
+	var locked []models.Achievement
+	if err := tx.Where("id NOT IN (?)",
+		tx.Model(&models.UserAchievement{}).Select("achievement_id").Where("user_id = ?", userID),
+	).Order("id").Find(&locked).Error; err != nil {
+		return nil, fmt.Errorf("failed to get locked achievements: %w", err)
+	}
+
+	m := newMeter(tx, userID)
+	now := time.Now()
+	var unlocked []Badge
+	for _, a := range locked {
+		progress, err := m.measure(a)
+		if err != nil {
+			return nil, err
+		}
+		if progress < a.Threshold {
+			continue
+		}
+
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.UserAchievement{
+			UserID:        userID,
+			AchievementID: a.ID,
+			UnlockedAt:    now,
+		})
+		if result.Error != nil {
+			return nil, fmt.Errorf("failed to unlock achievement: %w", result.Error)
+		}
+		if result.RowsAffected > 0 {
+			unlocked = append(unlocked, newBadge(a, progress, &now))
+		}
+	}
+	return unlocked, nil
+}
+
+// List returns every badge with the user's progress toward it
+func List(db *gorm.DB, userID uint) ([]Badge, error) {
+	var all []models.Achievement
+	if err := db.Order("id").Find(&all).Error; err != nil {
+		return nil, fmt.Errorf("failed to get achievements: %w", err)
+	}
+
+	var earned []models.UserAchievement
+	if err := db.Where("user_id = ?", userID).Find(&earned).Error; err != nil {
+		return nil, fmt.Errorf("failed to get user achievements: %w", err)
+	}
+	unlockedAt := make(map[uint]time.Time, len(earned))
+	for _, ua := range earned {
+		unlockedAt[ua.AchievementID] = ua.UnlockedAt
+	}
+
+	m := newMeter(db, userID)
+	badges := make([]Badge, 0, len(all))
+	for _, a := range all {
+		if at, ok := unlockedAt[a.ID]; ok {
+			badges = append(badges, newBadge(a, a.Threshold, &at))
+			continue
+		}
+		progress, err := m.measure(a)
+		if err != nil {
+			return nil, err
+		}
+		badges = append(badges, newBadge(a, progress, nil))
+	}
+	return badges, nil
+}
+
+// Unlocked returns the user's badges, most recent first
+func Unlocked(db *gorm.DB, userID uint) ([]Badge, error) {
+	var earned []models.UserAchievement
+	if err := db.Preload("Achievement").
+		Where("user_id = ?", userID).
+		Order("unlocked_at DESC, id DESC").
+		Find(&earned).Error; err != nil {
+		return nil, fmt.Errorf("failed to get user achievements: %w", err)
+	}
+
+	badges := make([]Badge, 0, len(earned))
+	for _, ua := range earned {
+		badges = append(badges, newBadge(ua.Achievement, ua.Achievement.Threshold, &ua.UnlockedAt))
+	}
+	return badges, nil
+}
+
+// meter measures a user's progress, querying each kind (and subject) once
+type meter struct {
+	db     *gorm.DB
+	userID uint
+	counts map[string]int64
+}
+
+func newMeter(db *gorm.DB, userID uint) *meter {
+	return &meter{db: db, userID: userID, counts: make(map[string]int64)}
+}
+
+func (m *meter) measure(a models.Achievement) (int64, error) {
+	key := a.Kind + ":" + a.Subject
+	if count, ok := m.counts[key]; ok {
+		return count, nil
+	}
+
+	var count int64
+	var err error
+	switch a.Kind {
+	case KindSolves:
+		err = m.db.Model(&models.UserPuzzle{}).
+			Where("user_id = ?", m.userID).
+			Count(&count).Error
+	case KindSubjectSolves:
+		err = m.db.Model(&models.UserPuzzle{}).
+			Joins("JOIN puzzles ON puzzles.id = user_puzzles.puzzle_id").
+			Where("user_puzzles.user_id = ? AND puzzles.subjects @> ?", m.userID, pq.StringArray{a.Subject}).
+			Count(&count).Error
+	case KindStreak:
+		var stats models.UserSolvedPuzzle
+		err = m.db.Where("user_id = ?", m.userID).Limit(1).Find(&stats).Error
+		count = int64(stats.BestStreak)
+	case KindRoomsEscaped, KindFlawlessRooms:
+		count, err = m.escapes(a.Kind == KindFlawlessRooms)
+	default:
+		return 0, fmt.Errorf("achievement %q has unknown kind %q", a.Code, a.Kind)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to measure achievement %q: %w", a.Code, err)
+	}
+
+	m.counts[key] = count
+	return count, nil
+}
+
+// escapes counts rooms the user escaped solo or with their current team,
+// optionally only those where no one used the room's hints: the user at any
+// time, and in a team escape any member during the session
+func (m *meter) escapes(flawless bool) (int64, error) {
+	teamID, err := team.TeamIDOf(m.db, m.userID)
+	if err != nil {
+		return 0, err
+	}
+
+	query := m.db.Model(&models.RoomSession{}).Where("status = ?", models.SessionEscaped)
+	if teamID != nil {
+		query = query.Where("((user_id = ? AND team_id IS NULL) OR team_id = ?)", m.userID, *teamID)
+	} else {
+		query = query.Where("user_id = ? AND team_id IS NULL", m.userID)
+	}
+	if flawless {
+		query = query.Where(`NOT EXISTS (
+			SELECT 1 FROM user_hints JOIN puzzles ON puzzles.id = user_hints.puzzle_id
+			WHERE puzzles.room_id = room_sessions.room_id AND (
+				user_hints.user_id = ? OR (
+					room_sessions.team_id IS NOT NULL
+					AND user_hints.unlocked_at BETWEEN room_sessions.started_at AND room_sessions.ended_at
+					AND user_hints.user_id IN (SELECT user_id FROM team_members WHERE team_id = room_sessions.team_id))))`, m.userID)
+	}
+
+	// A room escaped both solo and with the team counts once
+	var count int64
+	err = query.Distinct("room_id").Count(&count).Error
+	return count, err
+}
@@ -0,0 +1,165 @@
+package analytics
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/FieldPs/escape-room-backend/internal/models"
+	"github.com/FieldPs/escape-room-backend/internal/puzzle"
+	"gorm.io/gorm"
+)
+
+type WrongAnswer struct {
+	Answer string `json:"answer"`
+	Count  int64  `json:"count"`
+}
+
+type PuzzleAnalytics struct {
+	PuzzleID           uint          `json:"puzzle_id"`
+	Title              string        `json:"title"`
+	TotalAttempts      int64         `json:"total_attempts"`
+	CorrectAttempts    int64         `json:"correct_attempts"`
+	Solvers            int64         `json:"solvers"`               // Users who solved with recorded attempts
+	AvgAttemptsToSolve float64       `json:"avg_attempts_to_solve"` // Including the correct one
+	FirstTrySolveRate  float64       `json:"first_try_solve_rate"`  // Percentage of solvers
+	CommonWrongAnswers []WrongAnswer `json:"common_wrong_answers,omitempty"`
+}
+
+// attemptTotals aggregates raw attempt counts per puzzle
+type attemptTotals struct {
+	PuzzleID uint
+	Total    int64
+	Correct  int64
+}
+
+// solveTotals aggregates attempts-to-solve per puzzle
+type solveTotals struct {
+	PuzzleID     uint
+	Solvers      int64
+	AvgAttempts  float64
+	FirstTryRate float64
+}
+
+// attemptsToSolveSQL counts, for each user who solved a puzzle, the attempts
+// they made up to and including the solve
+const attemptsToSolveSQL = `
+SELECT a.puzzle_id, a.user_id, COUNT(*) AS attempts
+FROM attempts a
+JOIN user_puzzles up ON up.user_id = a.user_id AND up.puzzle_id = a.puzzle_id
+WHERE a.created_at <= up.solved_at
+GROUP BY a.puzzle_id, a.user_id`
+
+// ListPuzzleAnalytics returns summary analytics for every puzzle
+func ListPuzzleAnalytics(db *gorm.DB) ([]PuzzleAnalytics, error) {
+	var puzzles []models.Puzzle
+	if err := db.Select("id", "title").Order("id").Find(&puzzles).Error; err != nil {
+		return nil, fmt.Errorf("failed to get puzzles: %w", err)
+	}
+
+	attempts, err := getAttemptTotals(db, nil)
+	if err != nil {
+		return nil, err
+	}
+	solves, err := getSolveTotals(db, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]PuzzleAnalytics, 0, len(puzzles))
+	for _, p := range puzzles {
+		result = append(result, buildAnalytics(p, attempts[p.ID], solves[p.ID]))
+	}
+	return result, nil
+}
+
+// GetPuzzleAnalytics returns analytics for one puzzle including its most
+// common wrong answers
+func GetPuzzleAnalytics(db *gorm.DB, puzzleID uint, wrongAnswerLimit int) (*PuzzleAnalytics, error) {
+	var p models.Puzzle
+	if err := db.Select("id", "title").First(&p, puzzleID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, puzzle.ErrPuzzleNotFound
+		}
+		return nil, fmt.Errorf("failed to get puzzle: %w", err)
+	}
+
+	attempts, err := getAttemptTotals(db, &puzzleID)
+	if err != nil {
+		return nil, err
+	}
+	solves, err := getSolveTotals(db, &puzzleID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := buildAnalytics(p, attempts[p.ID], solves[p.ID])
+
+	if err := db.Model(&models.Attempt{}).
+		Select("answer, COUNT(*) AS count").
+		Where("puzzle_id = ? AND correct = ?", puzzleID, false).
+		Group("answer").
+		Order("count DESC, answer").
+		Limit(wrongAnswerLimit).
+		Scan(&result.CommonWrongAnswers).Error; err != nil {
+		return nil, fmt.Errorf("failed to get wrong answers: %w", err)
+	}
+	return &result, nil
+}
+
+func buildAnalytics(p models.Puzzle, attempts attemptTotals, solves solveTotals) PuzzleAnalytics {
+	return PuzzleAnalytics{
+		PuzzleID:           p.ID,
+		Title:              p.Title,
+		TotalAttempts:      attempts.Total,
+		CorrectAttempts:    attempts.Correct,
+		Solvers:            solves.Solvers,
+		AvgAttemptsToSolve: round2(solves.AvgAttempts),
+		FirstTrySolveRate:  round2(solves.FirstTryRate * 100),
+	}
+}
+
+func getAttemptTotals(db *gorm.DB, puzzleID *uint) (map[uint]attemptTotals, error) {
+	query := db.Model(&models.Attempt{}).
+		Select("puzzle_id, COUNT(*) AS total, SUM(CASE WHEN correct THEN 1 ELSE 0 END) AS correct").
+		Group("puzzle_id")
+	if puzzleID != nil {
+		query = query.Where("puzzle_id = ?", *puzzleID)
+	}
+
+	var rows []attemptTotals
+	if err := query.Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to count attempts: %w", err)
+	}
+
+	totals := make(map[uint]attemptTotals, len(rows))
+	for _, row := range rows {
+		totals[row.PuzzleID] = row
+	}
+	return totals, nil
+}
+
+func getSolveTotals(db *gorm.DB, puzzleID *uint) (map[uint]solveTotals, error) {
+	query := db.Table("(?) AS s", gorm.Expr(attemptsToSolveSQL)).
+		Select("puzzle_id, COUNT(*) AS solvers, AVG(attempts) AS avg_attempts, " +
+			"AVG(CASE WHEN attempts = 1 THEN 1.0 ELSE 0 END) AS first_try_rate").
+		Group("puzzle_id")
+	if puzzleID != nil {
+		query = query.Where("puzzle_id = ?", *puzzleID)
+	}
+
+	var rows []solveTotals
+	if err := query.Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to count attempts to solve: %w", err)
+	}
+
+	totals := make(map[uint]solveTotals, len(rows))
+	for _, row := range rows {
+		totals[row.PuzzleID] = row
+	}
+	return totals, nil
+}
+
+func round2(f float64) float64 {
+	return math.Round(f*100) / 100
+}
@@ -1,6 +1,10 @@
 package auth
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
 	"os"
 	"time"
 
@@ -8,7 +12,16 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
-var jwtSecret = []byte(os.Getenv("JWT_SECRET"))
+// Default token lifetimes; ACCESS_TOKEN_TTL and REFRESH_TOKEN_TTL override them
+const (
+	DefaultAccessTTL  = 15 * time.Minute
+	DefaultRefreshTTL = 30 * 24 * time.Hour
+)
+
+var (
+	ErrMissingTokenID = errors.New("token has no jti")
+	ErrWrongAudience  = errors.New("token was issued for something else")
+)
 
 type Claims struct {
 	UserID int
@@ -24,24 +37,144 @@ func CheckPasswordHash(password, hash string) bool {
 	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
 }
 
-func GenerateJWT(userID int) (string, error) {
+// AccessTTL is how long access tokens stay valid
+func AccessTTL() time.Duration {
+	return ttlFromEnv("ACCESS_TOKEN_TTL", DefaultAccessTTL)
+}
+
+// RefreshTTL is how long a refresh token can be used, counted from when it was issued
+func RefreshTTL() time.Duration {
+	return ttlFromEnv("REFRESH_TOKEN_TTL", DefaultRefreshTTL)
+}
+
+// ttlFromEnv is read on every call so values loaded from .env are picked up
+func ttlFromEnv(name string, fallback time.Duration) time.Duration {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return fallback
+	}
+	ttl, err := time.ParseDuration(raw)
+	if err != nil || ttl <= 0 {
+		log.Printf("Ignoring %s=%q: must be a positive duration such as 15m", name, raw)
+		return fallback
+	}
+	return ttl
+}
+
+// NewTokenID returns a random identifier for the jti claim
+func NewTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// GenerateJWT issues a short-lived access token. The returned claims carry
+// the jti and expiry needed to revoke it.
+func GenerateJWT(userID int) (string, *Claims, error) {
+	keys, err := Keys()
+	if err != nil {
+		return "", nil, err
+	}
+	jti, err := NewTokenID()
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now()
 	claims := &Claims{
 		UserID: userID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ID:        jti,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(AccessTTL())),
 		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	signed, err := keys.sign(claims)
+	if err != nil {
+		return "", nil, err
+	}
+	return signed, claims, nil
 }
 
+// ValidateJWT checks the signature against the key named by the kid header,
+// and the expiry. Tokens without a jti predate revocation and are rejected.
 func ValidateJWT(tokenStr string) (*Claims, error) {
+	keys, err := Keys()
+	if err != nil {
+		return nil, err
+	}
+
 	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-		return jwtSecret, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenStr, claims, keys.verificationKey)
 	if err != nil || !token.Valid {
 		return nil, err
 	}
+	if claims.ID == "" {
+		return nil, ErrMissingTokenID
+	}
+	// Action tokens carry an audience and must never work as access tokens
+	if len(claims.Audience) > 0 {
+		return nil, ErrWrongAudience
+	}
+	return claims, nil
+}
+
+// ActionClaims authorize one account action, named by the audience, such as
+// verifying an email address or resetting a password
+type ActionClaims struct {
+	UserID int
+	Email  string `json:"email,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// SignAction issues a token for the given action that expires after ttl
+func SignAction(action string, userID int, email string, ttl time.Duration) (string, *ActionClaims, error) {
+	keys, err := Keys()
+	if err != nil {
+		return "", nil, err
+	}
+	jti, err := NewTokenID()
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now()
+	claims := &ActionClaims{
+		UserID: userID,
+		Email:  email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Audience:  jwt.ClaimStrings{action},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+	signed, err := keys.sign(claims)
+	if err != nil {
+		return "", nil, err
+	}
+	return signed, claims, nil
+}
+
+// ValidateAction checks an action token's signature, expiry and action
+func ValidateAction(tokenStr string, action string) (*ActionClaims, error) {
+	keys, err := Keys()
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &ActionClaims{}
+	token, err := jwt.ParseWithClaims(tokenStr, claims, keys.verificationKey)
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid || claims.ID == "" {
+		return nil, ErrMissingTokenID
+	}
+	if !claims.VerifyAudience(action, true) {
+		return nil, ErrWrongAudience
+	}
 	return claims, nil
 }
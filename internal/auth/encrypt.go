@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// encryptionPrefix versions the ciphertext format so keys or algorithms can change later
+const encryptionPrefix = "v1:"
+
+var ErrEncryptionKeyMissing = errors.New("SOLUTION_ENCRYPTION_KEY is not set")
+
+// encryptionKey reads the AES-256 key from the environment. It is read on every
+// call rather than at init so values loaded from .env are picked up.
+func encryptionKey() ([]byte, error) {
+	encoded := os.Getenv("SOLUTION_ENCRYPTION_KEY")
+	if encoded == "" {
+		return nil, ErrEncryptionKeyMissing
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("SOLUTION_ENCRYPTION_KEY must be base64: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("SOLUTION_ENCRYPTION_KEY must decode to 32 bytes, got %d", len(key))
+	}
+	return key, nil
+}
+
+func newGCM() (cipher.AEAD, error) {
+	key, err := encryptionKey()
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Encrypt seals plaintext with AES-256-GCM using SOLUTION_ENCRYPTION_KEY
+func Encrypt(plaintext string) (string, error) {
+	gcm, err := newGCM()
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return encryptionPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value produced by Encrypt
+func Decrypt(ciphertext string) (string, error) {
+	if !strings.HasPrefix(ciphertext, encryptionPrefix) {
+		return "", errors.New("unsupported ciphertext format")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(ciphertext, encryptionPrefix))
+	if err != nil {
+		return "", err
+	}
+
+	gcm, err := newGCM()
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("ciphertext too short")
+	}
+
+	nonce, data := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, data, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
@@ -0,0 +1,311 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// LegacySecretKID is the kid given to the HS256 key from JWT_SECRET
+const LegacySecretKID = "default"
+
+// minSecretLen is the shortest HMAC secret accepted; a shorter one can be
+// brute-forced from any token it signed
+const minSecretLen = 32
+
+var (
+	ErrNoKeys     = errors.New("no JWT keys configured: set JWT_KEYS_DIR or JWT_SECRET")
+	ErrUnknownKID = errors.New("token signed with an unknown key")
+)
+
+// Key is one signing or verification key. Secret HMAC keys sign and verify
+// with the same bytes; asymmetric keys verify with Public and can only sign
+// when the private half is present.
+type Key struct {
+	ID      string
+	Method  jwt.SigningMethod
+	private interface{} // nil for verify-only keys
+	Public  interface{} // HMAC secret, *rsa.PublicKey or ed25519.PublicKey
+}
+
+// CanSign reports whether the private half of the key is loaded
+func (k *Key) CanSign() bool {
+	return k.private != nil
+}
+
+// KeyRing signs with one active key and verifies with every loaded key, so
+// tokens signed with the previous key stay valid during a rotation
+type KeyRing struct {
+	active *Key
+	keys   map[string]*Key
+}
+
+// NewKeyRing builds a ring that signs with the key activeKID. With an empty
+// activeKID the only signing key is used.
+func NewKeyRing(keys []*Key, activeKID string) (*KeyRing, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoKeys
+	}
+
+	ring := &KeyRing{keys: make(map[string]*Key, len(keys))}
+	var signers []*Key
+	for _, k := range keys {
+		if _, dup := ring.keys[k.ID]; dup {
+			return nil, fmt.Errorf("JWT key %q is configured twice", k.ID)
+		}
+		ring.keys[k.ID] = k
+		if k.CanSign() {
+			signers = append(signers, k)
+		}
+	}
+
+	switch {
+	case activeKID != "":
+		k, ok := ring.keys[activeKID]
+		if !ok {
+			return nil, fmt.Errorf("JWT_ACTIVE_KID %q does not match any key", activeKID)
+		}
+		if !k.CanSign() {
+			return nil, fmt.Errorf("JWT_ACTIVE_KID %q is a public key and cannot sign", activeKID)
+		}
+		ring.active = k
+	case len(signers) == 1:
+		ring.active = signers[0]
+	case len(signers) == 0:
+		return nil, errors.New("no JWT key can sign: every configured key is public only")
+	default:
+		return nil, fmt.Errorf("%d JWT keys can sign: set JWT_ACTIVE_KID to pick one", len(signers))
+	}
+	return ring, nil
+}
+
+// Active is the key new tokens are signed with
+func (r *KeyRing) Active() *Key {
+	return r.active
+}
+
+// sign signs claims with the active key, naming it in the kid header
+func (r *KeyRing) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(r.active.Method, claims)
+	token.Header["kid"] = r.active.ID
+	return token.SignedString(r.active.private)
+}
+
+// verificationKey is the jwt.Keyfunc: it picks the key named by the kid
+// header and refuses any algorithm other than that key's own
+func (r *KeyRing) verificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	k, ok := r.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKID
+	}
+	if token.Method.Alg() != k.Method.Alg() {
+		return nil, fmt.Errorf("key %q does not sign with %s", kid, token.Method.Alg())
+	}
+	return k.Public, nil
+}
+
+// JWK is a public key in JSON Web Key form
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`   // RSA modulus
+	E   string `json:"e,omitempty"`   // RSA exponent
+	Crv string `json:"crv,omitempty"` // OKP curve
+	X   string `json:"x,omitempty"`   // OKP public key
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS lists the public keys other services need to verify our tokens.
+// HMAC secrets are never published.
+func (r *KeyRing) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for _, id := range r.ids() {
+		k := r.keys[id]
+		switch pub := k.Public.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kty: "RSA",
+				Kid: k.ID,
+				Use: "sig",
+				Alg: k.Method.Alg(),
+				N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kty: "OKP",
+				Kid: k.ID,
+				Use: "sig",
+				Alg: k.Method.Alg(),
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(pub),
+			})
+		}
+	}
+	return set
+}
+
+func (r *KeyRing) ids() []string {
+	ids := make([]string, 0, len(r.keys))
+	for id := range r.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+var (
+	ringMu sync.RWMutex
+	ring   *KeyRing
+)
+
+// LoadKeys reads the key ring from the environment and installs it. Call it
+// once at startup and stop if it fails; no token can be issued without keys.
+//
+// Keys come from files in JWT_KEYS_DIR, each named after its kid:
+// <kid>.pem holds a PKCS#8 or PKCS#1 private key (RSA signs with RS256,
+// Ed25519 with EdDSA) or a PKIX public key for verification only, and
+// <kid>.secret holds an HS256 secret. JWT_SECRET, if set, adds an HS256 key
+// with kid "default". JWT_ACTIVE_KID picks the signing key when more than
+// one could sign.
+func LoadKeys() error {
+	var keys []*Key
+
+	if dir := os.Getenv("JWT_KEYS_DIR"); dir != "" {
+		loaded, err := loadKeyDir(dir)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, loaded...)
+	}
+	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		k, err := hmacKey(LegacySecretKID, []byte(secret))
+		if err != nil {
+			return fmt.Errorf("JWT_SECRET: %w", err)
+		}
+		keys = append(keys, k)
+	}
+
+	r, err := NewKeyRing(keys, os.Getenv("JWT_ACTIVE_KID"))
+	if err != nil {
+		return err
+	}
+	SetKeyRing(r)
+	log.Printf("JWT keys loaded: signing with %q (%s), %d key(s) verify", r.active.ID, r.active.Method.Alg(), len(r.keys))
+	return nil
+}
+
+// SetKeyRing replaces the key ring in use
+func SetKeyRing(r *KeyRing) {
+	ringMu.Lock()
+	defer ringMu.Unlock()
+	ring = r
+}
+
+// Keys returns the key ring in use, or ErrNoKeys before LoadKeys succeeded
+func Keys() (*KeyRing, error) {
+	ringMu.RLock()
+	defer ringMu.RUnlock()
+	if ring == nil {
+		return nil, ErrNoKeys
+	}
+	return ring, nil
+}
+
+func loadKeyDir(dir string) ([]*Key, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWT_KEYS_DIR: %w", err)
+	}
+
+	var keys []*Key
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		ext := filepath.Ext(e.Name())
+		if ext != ".pem" && ext != ".secret" {
+			continue
+		}
+		kid := strings.TrimSuffix(e.Name(), ext)
+
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JWT key %q: %w", kid, err)
+		}
+
+		var k *Key
+		if ext == ".secret" {
+			k, err = hmacKey(kid, []byte(strings.TrimSpace(string(data))))
+		} else {
+			k, err = pemKey(kid, data)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("JWT key %q: %w", kid, err)
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+func hmacKey(kid string, secret []byte) (*Key, error) {
+	if len(secret) < minSecretLen {
+		return nil, fmt.Errorf("HS256 secret must be at least %d bytes", minSecretLen)
+	}
+	return &Key{ID: kid, Method: jwt.SigningMethodHS256, private: secret, Public: secret}, nil
+}
+
+func pemKey(kid string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("not PEM encoded")
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch key := parsed.(type) {
+	case *rsa.PrivateKey:
+		return &Key{ID: kid, Method: jwt.SigningMethodRS256, private: key, Public: &key.PublicKey}, nil
+	case *rsa.PublicKey:
+		return &Key{ID: kid, Method: jwt.SigningMethodRS256, Public: key}, nil
+	case ed25519.PrivateKey:
+		return &Key{ID: kid, Method: jwt.SigningMethodEdDSA, private: crypto.Signer(key), Public: key.Public()}, nil
+	case ed25519.PublicKey:
+		return &Key{ID: kid, Method: jwt.SigningMethodEdDSA, Public: key}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %T: use RSA or Ed25519", parsed)
+}
@@ -0,0 +1,174 @@
+package events
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// Event types pushed to subscribers
+const (
+	PuzzleSolved   = "puzzle.solved"
+	HintUnlocked   = "hint.unlocked"
+	BadgeUnlocked  = "achievement.unlocked"
+	SessionStarted = "session.started"
+	SessionTick    = "session.tick"
+	SessionPaused  = "session.paused"
+	SessionResumed = "session.resumed"
+	SessionEnded   = "session.ended"
+)
+
+const (
+	// subscriberBuffer is how many events a subscriber may fall behind
+	// before further events are dropped for it
+	subscriberBuffer = 32
+
+	// historySize is how many recent events are kept for clients that
+	// reconnect and ask for what they missed
+	historySize = 256
+)
+
+// Event is something that happened to a user, a team or a room session.
+// UserID is the player who caused it; TeamID and SessionID are set when it
+// happened in a team or room session. IDs increase by one per published
+// event and restart with the process.
+type Event struct {
+	ID        uint64      `json:"id"`
+	Type      string      `json:"type"`
+	UserID    uint        `json:"user_id"`
+	TeamID    *uint       `json:"team_id,omitempty"`
+	SessionID *uint       `json:"session_id,omitempty"`
+	Data      interface{} `json:"data,omitempty"`
+	At        time.Time   `json:"at"`
+}
+
+// Filter selects the events a subscriber receives: its own, its team's and
+// those of the session it watches, or everyone's. Types, when set, limits
+// which event types are delivered.
+type Filter struct {
+	UserID    uint
+	TeamID    *uint
+	SessionID *uint
+	Everyone  bool
+	Types     []string
+}
+
+// Matches reports whether the filter selects the event
+func (f Filter) Matches(e Event) bool {
+	if len(f.Types) > 0 && !slices.Contains(f.Types, e.Type) {
+		return false
+	}
+	if f.Everyone {
+		return true
+	}
+	if f.SessionID != nil && e.SessionID != nil && *f.SessionID == *e.SessionID {
+		return true
+	}
+	if f.TeamID != nil && e.TeamID != nil && *f.TeamID == *e.TeamID {
+		return true
+	}
+	return f.UserID != 0 && e.UserID == f.UserID
+}
+
+// Subscription delivers matching events on C until it is unsubscribed
+type Subscription struct {
+	C      <-chan Event
+	ch     chan Event
+	filter Filter
+}
+
+// Hub is an in-process publish/subscribe hub. Publishing never blocks: a
+// subscriber that stops reading misses events instead of stalling solves.
+type Hub struct {
+	mu      sync.Mutex
+	subs    map[*Subscription]struct{}
+	seq     uint64
+	history []Event // The last historySize events, oldest first
+}
+
+func NewHub() *Hub {
+	return &Hub{subs: make(map[*Subscription]struct{})}
+}
+
+// Default is the hub the domain packages publish to
+var Default = NewHub()
+
+// Publish sends an event to every subscriber of the default hub
+func Publish(e Event) {
+	Default.Publish(e)
+}
+
+func (h *Hub) Subscribe(f Filter) *Subscription {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.subscribe(f)
+}
+
+// SubscribeSince subscribes and also returns the matching events published
+// after lastID, so a reconnecting client misses nothing in between. complete
+// is false when the history no longer reaches back to lastID, or lastID is
+// from before a restart; the client should then reload its state.
+func (h *Hub) SubscribeSince(f Filter, lastID uint64) (sub *Subscription, missed []Event, complete bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	oldest := h.seq - uint64(len(h.history)) + 1
+	complete = lastID <= h.seq && lastID+1 >= oldest
+	for _, e := range h.history {
+		if e.ID > lastID && f.Matches(e) {
+			missed = append(missed, e)
+		}
+	}
+	return h.subscribe(f), missed, complete
+}
+
+// LastID is the ID of the most recently published event
+func (h *Hub) LastID() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.seq
+}
+
+func (h *Hub) subscribe(f Filter) *Subscription {
+	ch := make(chan Event, subscriberBuffer)
+	sub := &Subscription{C: ch, ch: ch, filter: f}
+	h.subs[sub] = struct{}{}
+	return sub
+}
+
+// Unsubscribe stops delivery and closes the subscription's channel
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.subs[sub]; ok {
+		delete(h.subs, sub)
+		close(sub.ch)
+	}
+}
+
+func (h *Hub) Publish(e Event) {
+	if e.At.IsZero() {
+		e.At = time.Now()
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.seq++
+	e.ID = h.seq
+	if len(h.history) == historySize {
+		h.history = append(h.history[:0], h.history[1:]...)
+	}
+	h.history = append(h.history, e)
+
+	for sub := range h.subs {
+		if !sub.filter.Matches(e) {
+			continue
+		}
+		select {
+		case sub.ch <- e:
+		default: // Subscriber is too far behind
+		}
+	}
+}
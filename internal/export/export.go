@@ -0,0 +1,471 @@
+package export
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FieldPs/escape-room-backend/internal/achievements"
+	"github.com/FieldPs/escape-room-backend/internal/models"
+	"github.com/FieldPs/escape-room-backend/internal/stats"
+	"gorm.io/gorm"
+)
+
+// FormatVersion is bumped whenever the layout of the archive changes
+const FormatVersion = 1
+
+// DefaultSyncMaxRows is how many solves, attempts, hints and reviews an export
+// may hold and still be sent in the response; EXPORT_SYNC_MAX_ROWS overrides it
+const DefaultSyncMaxRows = 5000
+
+// JobTTL is how long a finished export can be downloaded
+const JobTTL = 24 * time.Hour
+
+// staleAfter is when a job that never finished, such as across a restart,
+// is given up on
+const staleAfter = time.Hour
+
+var (
+	ErrUserNotFound = errors.New("user not found")
+	ErrJobNotFound  = errors.New("export not found")
+	ErrJobNotReady  = errors.New("export is not ready yet")
+	ErrJobFailed    = errors.New("export failed, please request a new one")
+	ErrJobExpired   = errors.New("export has expired, please request a new one")
+)
+
+// Archive is everything stored about one user
+type Archive struct {
+	GeneratedAt  time.Time
+	Profile      Profile
+	Solves       []models.UserPuzzle
+	Stats        Stats
+	Attempts     []models.Attempt
+	Hints        []models.UserHint
+	Achievements []achievements.Badge
+	Reviews      Reviews
+}
+
+// Profile is the account as exported. Fields are listed here on purpose so
+// new User columns are only exported once someone decides they should be.
+type Profile struct {
+	ID              uint       `json:"id"`
+	Username        string     `json:"username"`
+	Email           *string    `json:"email"`
+	EmailVerified   bool       `json:"email_verified"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	TimeZone        string     `json:"time_zone"`
+	Role            string     `json:"role"`
+	ReviewMode      bool       `json:"review_mode"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+func newProfile(u models.User) Profile {
+	return Profile{
+		ID:              u.ID,
+		Username:        u.Username,
+		Email:           u.Email,
+		EmailVerified:   u.EmailVerifiedAt != nil,
+		EmailVerifiedAt: u.EmailVerifiedAt,
+		TimeZone:        u.TimeZone,
+		Role:            u.Role,
+		ReviewMode:      u.ReviewMode,
+		CreatedAt:       u.CreatedAt,
+	}
+}
+
+// Stats pairs the stored solve totals with the stats the app shows
+type Stats struct {
+	Record  *models.UserSolvedPuzzle `json:"record"` // nil before the first solve
+	Current *stats.UserStatsResponse `json:"current"`
+}
+
+// Reviews is the spaced-repetition queue and its history
+type Reviews struct {
+	Cards   []models.ReviewCard `json:"cards"`
+	History []models.Review     `json:"history"`
+}
+
+// Manifest describes the files in the zip
+type Manifest struct {
+	UserID        uint      `json:"user_id"`
+	GeneratedAt   time.Time `json:"generated_at"`
+	FormatVersion int       `json:"format_version"`
+	Files         []string  `json:"files"`
+}
+
+// JobView is an export job with the links to poll and download it
+type JobView struct {
+	models.ExportJob
+	StatusURL   string `json:"status_url"`
+	DownloadURL string `json:"download_url,omitempty"` // Set once the export is ready
+}
+
+// SyncMaxRows is read on every call so values loaded from .env are picked up
+func SyncMaxRows() int64 {
+	raw := os.Getenv("EXPORT_SYNC_MAX_ROWS")
+	if raw == "" {
+		return DefaultSyncMaxRows
+	}
+	n, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || n < 0 {
+		log.Printf("Ignoring EXPORT_SYNC_MAX_ROWS=%q: must be a whole number", raw)
+		return DefaultSyncMaxRows
+	}
+	return n
+}
+
+// Dir is where finished exports are kept, EXPORT_DIR or a temp directory
+func Dir() string {
+	if dir := os.Getenv("EXPORT_DIR"); dir != "" {
+		return dir
+	}
+	return filepath.Join(os.TempDir(), "escape-room-exports")
+}
+
+// Rows counts the user's records that grow with play, to decide whether the
+// export is small enough to send right away
+func Rows(db *gorm.DB, userID uint) (int64, error) {
+	var total int64
+	for _, model := range []interface{}{&models.UserPuzzle{}, &models.Attempt{}, &models.UserHint{}, &models.Review{}} {
+		var n int64
+		if err := db.Model(model).Where("user_id = ?", userID).Count(&n).Error; err != nil {
+			return 0, fmt.Errorf("failed to count export rows: %w", err)
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// Collect reads the user's data
+func Collect(db *gorm.DB, userID uint) (*Archive, error) {
+	a := &Archive{GeneratedAt: time.Now().UTC()}
+
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	a.Profile = newProfile(user)
+
+	lists := []struct {
+		name string
+		dest interface{}
+		by   string
+	}{
+		{"solves", &a.Solves, "solved_at, id"},
+		{"attempts", &a.Attempts, "created_at, id"},
+		{"hints", &a.Hints, "unlocked_at, id"},
+		{"review cards", &a.Reviews.Cards, "id"},
+		{"reviews", &a.Reviews.History, "reviewed_at, id"},
+	}
+	for _, l := range lists {
+		if err := db.Where("user_id = ?", userID).Order(l.by).Find(l.dest).Error; err != nil {
+			return nil, fmt.Errorf("failed to get %s: %w", l.name, err)
+		}
+	}
+
+	var record models.UserSolvedPuzzle
+	if err := db.Where("user_id = ?", userID).Limit(1).Find(&record).Error; err != nil {
+		return nil, fmt.Errorf("failed to get solve totals: %w", err)
+	}
+	if record.ID != 0 {
+		a.Stats.Record = &record
+	}
+
+	var err error
+	if a.Stats.Current, err = stats.GetUserStats(db, userID); err != nil {
+		return nil, err
+	}
+	if a.Achievements, err = achievements.Unlocked(db, userID); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// WriteZip writes the archive as a zip of JSON files
+func (a *Archive) WriteZip(w io.Writer) error {
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", a.Profile},
+		{"solves.json", a.Solves},
+		{"stats.json", a.Stats},
+		{"attempts.json", a.Attempts},
+		{"hints.json", a.Hints},
+		{"achievements.json", a.Achievements},
+		{"reviews.json", a.Reviews},
+	}
+
+	manifest := Manifest{UserID: a.Profile.ID, GeneratedAt: a.GeneratedAt, FormatVersion: FormatVersion}
+	for _, f := range files {
+		manifest.Files = append(manifest.Files, f.name)
+	}
+
+	zw := zip.NewWriter(w)
+	if err := writeJSON(zw, "manifest.json", manifest, a.GeneratedAt); err != nil {
+		return err
+	}
+	for _, f := range files {
+		if err := writeJSON(zw, f.name, f.data, a.GeneratedAt); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func writeJSON(zw *zip.Writer, name string, v interface{}, modified time.Time) error {
+	fw, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+	if err != nil {
+		return fmt.Errorf("failed to add %s: %w", name, err)
+	}
+	enc := json.NewEncoder(fw)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+// FileName is the name offered when the zip is downloaded
+func FileName(username string, at time.Time) string {
+	safe := strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, username)
+	return fmt.Sprintf("export-%s-%s.zip", safe, at.Format("20060102"))
+}
+
+// Start queues an export job and builds it in the background. A job already
+// running for the user is returned instead of starting another.
+func Start(db *gorm.DB, userID uint) (*JobView, error) {
+	var job models.ExportJob
+	err := db.Where("user_id = ? AND status = ? AND created_at > ?", userID, models.ExportPending, time.Now().Add(-staleAfter)).
+		Order("id DESC").
+		Limit(1).
+		Find(&job).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get export jobs: %w", err)
+	}
+	if job.ID != 0 {
+		return newJobView(job), nil
+	}
+
+	job = models.ExportJob{
+		UserID:    userID,
+		Status:    models.ExportPending,
+		ExpiresAt: time.Now().Add(JobTTL),
+	}
+	if err := db.Create(&job).Error; err != nil {
+		return nil, fmt.Errorf("failed to create export job: %w", err)
+	}
+
+	go build(db, job)
+	return newJobView(job), nil
+}
+
+// build writes the zip for a job next to its final path and moves it in place
+// once complete, so a download never sees half a file
+func build(db *gorm.DB, job models.ExportJob) {
+	status := models.ExportFailed
+	var size int64
+	defer func() {
+		now := time.Now()
+		if err := db.Model(&job).Updates(map[string]interface{}{
+			"status":       status,
+			"size_bytes":   size,
+			"completed_at": now,
+			"expires_at":   now.Add(JobTTL),
+		}).Error; err != nil {
+			log.Printf("Export %d: failed to update job: %v", job.ID, err)
+		}
+	}()
+
+	archive, err := Collect(db, job.UserID)
+	if err != nil {
+		log.Printf("Export %d: %v", job.ID, err)
+		return
+	}
+	if err := os.MkdirAll(Dir(), 0o700); err != nil {
+		log.Printf("Export %d: failed to create export dir: %v", job.ID, err)
+		return
+	}
+
+	path := FilePath(job)
+	f, err := os.CreateTemp(Dir(), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		log.Printf("Export %d: failed to create file: %v", job.ID, err)
+		return
+	}
+	defer os.Remove(f.Name()) // No-op once renamed
+
+	if err := archive.WriteZip(f); err != nil {
+		f.Close()
+		log.Printf("Export %d: %v", job.ID, err)
+		return
+	}
+	if err := f.Close(); err != nil {
+		log.Printf("Export %d: failed to write file: %v", job.ID, err)
+		return
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		log.Printf("Export %d: failed to store file: %v", job.ID, err)
+		return
+	}
+
+	if info, err := os.Stat(path); err == nil {
+		size = info.Size()
+	}
+	status = models.ExportReady
+}
+
+// GetJob returns one of the user's export jobs
+func GetJob(db *gorm.DB, userID uint, jobID uint) (*JobView, error) {
+	job, err := getJob(db, userID, jobID)
+	if err != nil {
+		return nil, err
+	}
+	return newJobView(*job), nil
+}
+
+// Download returns the path of a finished export and the name to offer it as
+func Download(db *gorm.DB, userID uint, jobID uint) (string, string, error) {
+	job, err := getJob(db, userID, jobID)
+	if err != nil {
+		return "", "", err
+	}
+	switch {
+	case job.Status == models.ExportFailed:
+		return "", "", ErrJobFailed
+	case job.Status != models.ExportReady:
+		return "", "", ErrJobNotReady
+	case !job.ExpiresAt.After(time.Now()):
+		return "", "", ErrJobExpired
+	}
+
+	path := FilePath(*job)
+	if _, err := os.Stat(path); err != nil {
+		return "", "", ErrJobExpired
+	}
+
+	var user models.User
+	if err := db.Select("id", "username").First(&user, userID).Error; err != nil {
+		return "", "", fmt.Errorf("failed to get user: %w", err)
+	}
+	return path, FileName(user.Username, job.CreatedAt), nil
+}
+
+func getJob(db *gorm.DB, userID uint, jobID uint) (*models.ExportJob, error) {
+	var job models.ExportJob
+	if err := db.Where("id = ? AND user_id = ?", jobID, userID).First(&job).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrJobNotFound
+		}
+		return nil, fmt.Errorf("failed to get export job: %w", err)
+	}
+	return &job, nil
+}
+
+func newJobView(job models.ExportJob) *JobView {
+	base := fmt.Sprintf("/api/v1/me/exports/%d", job.ID)
+	view := &JobView{ExportJob: job, StatusURL: base}
+	if job.Status == models.ExportReady {
+		view.DownloadURL = base + "/download"
+	}
+	return view
+}
+
+// FilePath is where a job's zip is kept. Names start with the user ID so
+// RemoveUserFiles can find them.
+func FilePath(job models.ExportJob) string {
+	return filepath.Join(Dir(), fmt.Sprintf("%d-%d.zip", job.UserID, job.ID))
+}
+
+// RemoveUserFiles deletes every stored export of a user, such as when the
+// account is deleted
+func RemoveUserFiles(userID uint) error {
+	paths, err := filepath.Glob(filepath.Join(Dir(), fmt.Sprintf("%d-*.zip", userID)))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove export: %w", err)
+		}
+	}
+	return nil
+}
+
+// Purge deletes expired export jobs and their files, fails jobs that never
+// finished, and removes files no job points to any more
+func Purge(db *gorm.DB, now time.Time) (int64, error) {
+	if err := db.Model(&models.ExportJob{}).
+		Where("status = ? AND created_at <= ?", models.ExportPending, now.Add(-staleAfter)).
+		Update("status", models.ExportFailed).Error; err != nil {
+		return 0, fmt.Errorf("failed to fail stale exports: %w", err)
+	}
+
+	var expired []models.ExportJob
+	if err := db.Where("expires_at <= ?", now).Find(&expired).Error; err != nil {
+		return 0, fmt.Errorf("failed to get expired exports: %w", err)
+	}
+	for _, job := range expired {
+		if err := os.Remove(FilePath(job)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Export purger: %v", err)
+		}
+	}
+	result := db.Where("expires_at <= ?", now).Delete(&models.ExportJob{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to purge exports: %w", result.Error)
+	}
+
+	// Files outlive their rows when a purge is interrupted
+	entries, err := os.ReadDir(Dir())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return result.RowsAffected, fmt.Errorf("failed to read export dir: %w", err)
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || (!strings.HasSuffix(name, ".zip") && !strings.HasSuffix(name, ".tmp")) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || now.Sub(info.ModTime()) < JobTTL+staleAfter {
+			continue
+		}
+		os.Remove(filepath.Join(Dir(), name))
+	}
+	return result.RowsAffected, nil
+}
+
+// RunPurger purges expired exports every interval until ctx is done
+func RunPurger(ctx context.Context, db *gorm.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if n, err := Purge(db, time.Now()); err != nil {
+				log.Println("Export purger:", err)
+			} else if n > 0 {
+				log.Printf("Export purger: removed %d expired export(s)", n)
+			}
+		}
+	}
+}
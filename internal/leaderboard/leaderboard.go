@@ -0,0 +1,353 @@
+package leaderboard
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/FieldPs/escape-room-backend/internal/models"
+	"github.com/FieldPs/escape-room-backend/internal/team"
+	"github.com/FieldPs/escape-room-backend/internal/validation"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+// What a board ranks by
+const (
+	KindSolves  = "solves"  // Puzzles solved, most first
+	KindStreak  = "streak"  // Consecutive days with a solve, longest first
+	KindFastest = "fastest" // Room escape time in seconds, quickest first
+)
+
+// Rolling windows a board can cover
+const (
+	WindowAll  = "all"
+	WindowWeek = "week"
+	WindowDay  = "day"
+)
+
+var (
+	Kinds   = []string{KindSolves, KindStreak, KindFastest}
+	Windows = []string{WindowAll, WindowWeek, WindowDay}
+)
+
+const (
+	DefaultLimit = 10
+	MaxLimit     = 100
+)
+
+// Query selects a board. Subject and RoomID narrow solves to matching
+// puzzles; fastest needs a room.
+type Query struct {
+	Kind    string
+	Window  string
+	Subject string
+	RoomID  *uint
+	Limit   int
+}
+
+// Entry is one ranked player, or one team for team escapes. Ties share a rank.
+type Entry struct {
+	Rank     int64   `json:"rank"`
+	UserID   uint    `json:"user_id"`
+	Username string  `json:"username"`
+	TeamID   *uint   `json:"team_id,omitempty"`
+	TeamName string  `json:"team_name,omitempty"`
+	Value    float64 `json:"value"` // Solves, streak days or seconds, depending on kind
+}
+
+type Board struct {
+	Kind    string  `json:"kind"`
+	Window  string  `json:"window"`
+	Subject string  `json:"subject,omitempty"`
+	RoomID  *uint   `json:"room_id,omitempty"`
+	Entries []Entry `json:"entries"`
+	Me      *Entry  `json:"me"` // The caller's standing even outside the top entries; nil when unranked
+}
+
+// Validate fills in defaults and checks the combination of options
+func (q *Query) Validate() error {
+	if q.Kind == "" {
+		q.Kind = KindSolves
+	}
+	if q.Window == "" {
+		q.Window = WindowAll
+	}
+	if q.Limit == 0 {
+		q.Limit = DefaultLimit
+	}
+	q.Subject = strings.TrimSpace(q.Subject)
+
+	if !slices.Contains(Kinds, q.Kind) {
+		return &validation.Error{Field: "kind", Message: "must be one of " + strings.Join(Kinds, ", ")}
+	}
+	if !slices.Contains(Windows, q.Window) {
+		return &validation.Error{Field: "window", Message: "must be one of " + strings.Join(Windows, ", ")}
+	}
+	if q.Limit < 1 || q.Limit > MaxLimit {
+		return &validation.Error{Field: "limit", Message: fmt.Sprintf("must be between 1 and %d", MaxLimit)}
+	}
+	if q.Subject != "" {
+		if q.Kind != KindSolves {
+			return &validation.Error{Field: "subject", Message: "only allowed for the solves board"}
+		}
+		if !slices.Contains(models.Subjects, q.Subject) {
+			return &validation.Error{
+				Field:   "subject",
+				Message: fmt.Sprintf("unknown subject %q, expected one of %s", q.Subject, strings.Join(models.Subjects, ", ")),
+			}
+		}
+	}
+	if q.RoomID != nil && q.Kind == KindStreak {
+		return &validation.Error{Field: "room_id", Message: "not allowed for the streak board"}
+	}
+	if q.RoomID == nil && q.Kind == KindFastest {
+		return &validation.Error{Field: "room_id", Message: "required for the fastest board"}
+	}
+	return nil
+}
+
+// since is the start of the query's window, or zero for all time
+func (q *Query) since(now time.Time) time.Time {
+	switch q.Window {
+	case WindowDay:
+		return now.Add(-24 * time.Hour)
+	case WindowWeek:
+		return now.Add(-7 * 24 * time.Hour)
+	}
+	return time.Time{}
+}
+
+// Get returns the top entries of a board plus the caller's own entry
+func Get(db *gorm.DB, userID uint, q Query) (*Board, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+
+	src := newSource(db, &q, time.Now())
+	board := newBoard(&q)
+
+	var err error
+	if board.Entries, err = src.top(); err != nil {
+		return nil, err
+	}
+
+	me, err := src.standing(userID)
+	if err != nil {
+		return nil, err
+	}
+	board.Me = me
+
+	entries := make([]*Entry, 0, len(board.Entries)+1)
+	for i := range board.Entries {
+		entries = append(entries, &board.Entries[i])
+	}
+	if me != nil {
+		entries = append(entries, me)
+	}
+	if err := fillNames(db, entries); err != nil {
+		return nil, err
+	}
+	return board, nil
+}
+
+func newBoard(q *Query) *Board {
+	return &Board{
+		Kind:    q.Kind,
+		Window:  q.Window,
+		Subject: q.Subject,
+		RoomID:  q.RoomID,
+		Entries: []Entry{},
+	}
+}
+
+// source builds the per-player (or per-session) values a board ranks.
+// Every row has user_id, team_id and value columns.
+type source struct {
+	db    *gorm.DB
+	q     *Query
+	since time.Time
+}
+
+func newSource(db *gorm.DB, q *Query, now time.Time) *source {
+	return &source{db: db, q: q, since: q.since(now)}
+}
+
+// ascending boards rank the lowest value first
+func (s *source) ascending() bool {
+	return s.q.Kind == KindFastest
+}
+
+func (s *source) direction() string {
+	if s.ascending() {
+		return "ASC"
+	}
+	return "DESC"
+}
+
+// rows returns a fresh query for the board's rows; it is used as a subquery
+// more than once, so it must not be shared
+func (s *source) rows() *gorm.DB {
+	switch s.q.Kind {
+	case KindStreak:
+		return s.streakRows()
+	case KindFastest:
+		return s.fastestRows()
+	}
+	return s.solveRows()
+}
+
+func (s *source) solveRows() *gorm.DB {
+	// All-time totals are kept per user, so the common board never touches
+	// individual solves
+	if s.since.IsZero() && s.q.Subject == "" && s.q.RoomID == nil {
+		return s.db.Model(&models.UserSolvedPuzzle{}).
+			Select("user_id, NULL::bigint AS team_id, solved_puzzles AS value").
+			Where("solved_puzzles > 0")
+	}
+
+	// Team solves kept from deleted accounts have user_id 0 and rank no one
+	query := s.db.Model(&models.UserPuzzle{}).
+		Select("user_puzzles.user_id, NULL::bigint AS team_id, COUNT(*) AS value").
+		Where("user_puzzles.user_id <> 0").
+		Group("user_puzzles.user_id")
+	if !s.since.IsZero() {
+		query = query.Where("user_puzzles.solved_at >= ?", s.since)
+	}
+	if s.q.Subject != "" || s.q.RoomID != nil {
+		query = query.Joins("JOIN puzzles ON puzzles.id = user_puzzles.puzzle_id")
+	}
+	if s.q.Subject != "" {
+		query = query.Where("puzzles.subjects @> ?", pq.StringArray{s.q.Subject})
+	}
+	if s.q.RoomID != nil {
+		query = query.Where("puzzles.room_id = ?", *s.q.RoomID)
+	}
+	return query
+}
+
+// streakRows ranks the best streak ever, or for a window the current streak
+// of players who solved something in it
+func (s *source) streakRows() *gorm.DB {
+	if s.since.IsZero() {
+		return s.db.Model(&models.UserSolvedPuzzle{}).
+			Select("user_id, NULL::bigint AS team_id, best_streak AS value").
+			Where("best_streak > 0")
+	}
+	return s.db.Model(&models.UserSolvedPuzzle{}).
+		Select("user_id, NULL::bigint AS team_id, current_streak AS value").
+		Where("current_streak > 0 AND streak_day_at >= ?", s.since)
+}
+
+// fastestRows ranks escaped sessions of the room by play time, pauses excluded
+func (s *source) fastestRows() *gorm.DB {
+	query := s.db.Model(&models.RoomSession{}).
+		Select("user_id, team_id, EXTRACT(EPOCH FROM ended_at - started_at) - paused_seconds AS value").
+		Where("room_id = ? AND status = ?", *s.q.RoomID, models.SessionEscaped)
+	if !s.since.IsZero() {
+		query = query.Where("ended_at >= ?", s.since)
+	}
+	return query
+}
+
+// top ranks the board and returns its first Limit entries, without names
+func (s *source) top() ([]Entry, error) {
+	entries := []Entry{}
+	if err := s.db.Table("(?) AS board", s.rows()).
+		Select(fmt.Sprintf("board.user_id, board.team_id, board.value, RANK() OVER (ORDER BY board.value %s) AS rank", s.direction())).
+		Order("rank, board.user_id").
+		Limit(s.q.Limit).
+		Scan(&entries).Error; err != nil {
+		return nil, fmt.Errorf("failed to rank players: %w", err)
+	}
+	return entries, nil
+}
+
+// standing returns the user's best row and its rank, or nil when unranked.
+// Team escapes count for every current member.
+func (s *source) standing(userID uint) (*Entry, error) {
+	mine := s.db.Table("(?) AS board", s.rows())
+	if s.q.Kind == KindFastest {
+		teamID, err := team.TeamIDOf(s.db, userID)
+		if err != nil {
+			return nil, err
+		}
+		if teamID != nil {
+			mine = mine.Where("((board.user_id = ? AND board.team_id IS NULL) OR board.team_id = ?)", userID, *teamID)
+		} else {
+			mine = mine.Where("board.user_id = ? AND board.team_id IS NULL", userID)
+		}
+	} else {
+		mine = mine.Where("board.user_id = ?", userID)
+	}
+
+	var entries []Entry
+	if err := mine.Select("board.user_id, board.team_id, board.value").
+		Order("board.value " + s.direction()).
+		Limit(1).
+		Scan(&entries).Error; err != nil {
+		return nil, fmt.Errorf("failed to get standing: %w", err)
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	me := entries[0]
+
+	better := "board.value > ?"
+	if s.ascending() {
+		better = "board.value < ?"
+	}
+	var ahead int64
+	if err := s.db.Table("(?) AS board", s.rows()).
+		Where(better, me.Value).
+		Count(&ahead).Error; err != nil {
+		return nil, fmt.Errorf("failed to rank user: %w", err)
+	}
+	me.Rank = ahead + 1
+	return &me, nil
+}
+
+// fillNames sets usernames and team names on entries
+func fillNames(db *gorm.DB, entries []*Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	userIDs := make([]uint, 0, len(entries))
+	var teamIDs []uint
+	for _, e := range entries {
+		userIDs = append(userIDs, e.UserID)
+		if e.TeamID != nil {
+			teamIDs = append(teamIDs, *e.TeamID)
+		}
+	}
+
+	var users []models.User
+	if err := db.Select("id", "username").Where("id IN ?", userIDs).Find(&users).Error; err != nil {
+		return fmt.Errorf("failed to get usernames: %w", err)
+	}
+	usernames := make(map[uint]string, len(users))
+	for _, u := range users {
+		usernames[u.ID] = u.Username
+	}
+
+	teamNames := make(map[uint]string)
+	if len(teamIDs) > 0 {
+		var teams []models.Team
+		if err := db.Select("id", "name").Where("id IN ?", teamIDs).Find(&teams).Error; err != nil {
+			return fmt.Errorf("failed to get team names: %w", err)
+		}
+		for _, t := range teams {
+			teamNames[t.ID] = t.Name
+		}
+	}
+
+	for _, e := range entries {
+		e.Username = usernames[e.UserID]
+		if e.TeamID != nil {
+			e.TeamName = teamNames[*e.TeamID]
+		}
+	}
+	return nil
+}
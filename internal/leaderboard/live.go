@@ -0,0 +1,110 @@
+package leaderboard
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Live serves one board to many readers, such as every open stats stream.
+// The top entries are ranked at most once per interval and shared instead of
+// once per reader; each reader only looks up their own standing.
+type Live struct {
+	db       *gorm.DB
+	q        Query
+	interval time.Duration
+	version  func() uint64 // What a ranking reflects, such as the last hub event ID
+
+	mu      sync.Mutex
+	top     *ranking
+	ranking bool // A reader is ranking the board now
+}
+
+// ranking is the shared top of the board at one version
+type ranking struct {
+	entries []Entry
+	version uint64
+	at      time.Time
+}
+
+// NewLive validates q and returns a shared board for it. Only boards with one
+// row per player can be shared, so fastest is not allowed.
+func NewLive(db *gorm.DB, q Query, interval time.Duration, version func() uint64) (*Live, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	if q.Kind == KindFastest {
+		return nil, errors.New("the fastest board cannot be shared")
+	}
+	return &Live{db: db, q: q, interval: interval, version: version}, nil
+}
+
+// Board returns the board with userID's standing. The top is ranked again
+// when it does not reflect version want yet and the last ranking is at least
+// an interval old. Ranking runs outside the lock, and readers arriving in the
+// meantime get the previous top. current reports whether the returned top
+// reflects want, so callers can ask again later when it does not; board is
+// nil while the first ranking is still running.
+func (l *Live) Board(userID uint, username string, want uint64) (board *Board, current bool, err error) {
+	l.mu.Lock()
+	top := l.top
+	refresh := !l.ranking && (top == nil || (top.version < want && time.Since(top.at) >= l.interval))
+	if refresh {
+		l.ranking = true
+	}
+	l.mu.Unlock()
+
+	if refresh {
+		fresh, err := l.rank()
+		l.mu.Lock()
+		l.ranking = false
+		if err == nil {
+			l.top = fresh
+		}
+		top = l.top
+		l.mu.Unlock()
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	if top == nil {
+		return nil, false, nil
+	}
+
+	q := l.q
+	me, err := newSource(l.db, &q, time.Now()).standing(userID)
+	if err != nil {
+		return nil, false, err
+	}
+	if me != nil {
+		me.Username = username
+	}
+
+	board = newBoard(&q)
+	board.Entries = top.entries
+	board.Me = me
+	return board, top.version >= want, nil
+}
+
+// rank loads and names the top entries
+func (l *Live) rank() (*ranking, error) {
+	// Read the version first so a change made while ranking is not missed
+	version := l.version()
+	now := time.Now()
+	q := l.q
+
+	entries, err := newSource(l.db, &q, now).top()
+	if err != nil {
+		return nil, err
+	}
+	named := make([]*Entry, len(entries))
+	for i := range entries {
+		named[i] = &entries[i]
+	}
+	if err := fillNames(l.db, named); err != nil {
+		return nil, err
+	}
+	return &ranking{entries: entries, version: version, at: now}, nil
+}
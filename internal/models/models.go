@@ -4,40 +4,353 @@ import (
 	"time"
 
 	"github.com/lib/pq"
+	"gorm.io/gorm"
 )
 
+// User roles
+const (
+	RolePlayer = "player"
+	RoleAdmin  = "admin"
+)
+
+// Answer matching modes
+const (
+	MatchExact           = "exact"            // Byte-for-byte comparison
+	MatchCaseInsensitive = "case_insensitive" // Trimmed, case-folded comparison
+	MatchNumeric         = "numeric"          // Parsed as numbers, equal within Tolerance
+	MatchRegex           = "regex"            // Solution is a regular expression
+	MatchAlternatives    = "alternatives"     // Solution or any of Alternatives, case-insensitive
+)
+
+// Room difficulties
+const (
+	DifficultyEasy   = "easy"
+	DifficultyMedium = "medium"
+	DifficultyHard   = "hard"
+)
+
+// Room session statuses
+const (
+	SessionActive    = "active"
+	SessionPaused    = "paused"
+	SessionEscaped   = "escaped"   // Every puzzle solved before the deadline
+	SessionFailed    = "failed"    // Deadline passed
+	SessionAbandoned = "abandoned" // Given up by the player
+)
+
+// Team roles and invite statuses
+const (
+	TeamRoleCaptain = "captain"
+	TeamRoleMember  = "member"
+
+	InvitePending  = "pending"
+	InviteAccepted = "accepted"
+	InviteDeclined = "declined"
+)
+
+// Data export job statuses
+const (
+	ExportPending = "pending"
+	ExportReady   = "ready"
+	ExportFailed  = "failed"
+)
+
+// Subjects a puzzle can be tagged with
+var Subjects = []string{"Physics", "Chemistry", "Biology", "Math", "Thai", "English", "Social"}
+
 // In models/user.go
 type User struct {
 	ID           uint      `gorm:"primaryKey" json:"id"`
 	Username     string    `gorm:"unique" json:"username"`
 	Password     string    `gorm:"-" json:"password"` // Only for input, not stored
 	PasswordHash string    `json:"-"`                 // Only stored in DB
+	Role         string    `gorm:"default:player" json:"role"`
+	TimeZone     string    `gorm:"default:UTC" json:"time_zone"` // IANA name; decides where streak days end
+	ReviewMode   bool      `json:"review_mode"`                  // Opted in to spaced-repetition reviews
 	CreatedAt    time.Time `json:"created_at"`
+
+	// Optional; only a verified address can receive password resets
+	Email           *string    `gorm:"uniqueIndex" json:"email"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+
+	// Glicko skill rating, updated on every answer
+	Rating          float64 `gorm:"default:1500" json:"rating"`
+	RatingDeviation float64 `gorm:"default:350" json:"rating_deviation"`
 }
 
 type Puzzle struct {
-	ID        uint           `gorm:"primaryKey" json:"id"`
-	Title     string         `json:"title"`
-	Content   string         `json:"content"`
-	Solution  string         `json:"-"`
-	Subjects  pq.StringArray `json:"subjects" gorm:"type:text[]"`
-	CreatedAt time.Time      `json:"created_at"`
+	ID             uint           `gorm:"primaryKey" json:"id"`
+	Title          string         `json:"title"`
+	Content        string         `json:"content"`
+	Solution       string         `gorm:"-" json:"-"`                                                      // Only for input, never stored in plaintext
+	SolutionHash   string         `json:"-"`                                                               // bcrypt hash for exact and case-insensitive modes
+	SolutionCipher string         `json:"-"`                                                               // AES-GCM ciphertext for modes that need the plaintext
+	Subjects       pq.StringArray `json:"subjects" gorm:"type:text[];index:idx_puzzles_subjects,type:gin"` // GIN for subject filters
+	MatchMode      string         `gorm:"default:exact" json:"match_mode"`
+	Difficulty     string         `gorm:"default:medium" json:"difficulty"`
+	Tolerance      float64        `json:"tolerance"`                 // Only used by MatchNumeric
+	Alternatives   pq.StringArray `gorm:"type:text[]" json:"-"`      // Only used by MatchAlternatives, stored encrypted
+	Hints          pq.StringArray `gorm:"type:text[]" json:"hints"`  // Ordered, unlocked one at a time
+	RoomID         *uint          `gorm:"index" json:"room_id"`      // nil for free-play puzzles
+	RoomPosition   int            `json:"room_position"`             // Order inside the room
+	PublishAt      *time.Time     `gorm:"index" json:"publish_at"`   // Hidden from players before this; nil means always
+	UnpublishAt    *time.Time     `gorm:"index" json:"unpublish_at"` // Hidden from players from this on; nil means never
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"` // Soft delete
+
+	// Glicko rating measured from player answers; higher is harder
+	Rating          float64 `gorm:"default:1500;index" json:"rating"`
+	RatingDeviation float64 `gorm:"default:350" json:"rating_deviation"`
+}
+
+// Published limits a puzzle query to puzzles players can see at the given time
+func Published(now time.Time) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("(puzzles.publish_at IS NULL OR puzzles.publish_at <= ?) AND (puzzles.unpublish_at IS NULL OR puzzles.unpublish_at > ?)", now, now)
+	}
 }
 
 type UserPuzzle struct {
-	ID       uint      `gorm:"primaryKey" json:"id"`
-	UserID   uint      `gorm:"index" json:"user_id"`
-	PuzzleID uint      `gorm:"index" json:"puzzle_id"`
-	SolvedAt time.Time `json:"solved_at"`
-	Puzzle   Puzzle    `gorm:"foreignKey:PuzzleID" json:"-"` // For Preload
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"index" json:"user_id"`
+	PuzzleID  uint      `gorm:"index" json:"puzzle_id"`
+	TeamID    *uint     `gorm:"index" json:"team_id"`    // Set when solved in a team session, counts for every member
+	SessionID *uint     `gorm:"index" json:"session_id"` // Room session the solve was made in, for session totals
+	SolvedAt  time.Time `gorm:"index" json:"solved_at"`
+	HintsUsed int       `json:"hints_used"`
+	Score     int       `json:"score"`
+	Puzzle    Puzzle    `gorm:"foreignKey:PuzzleID" json:"-"` // For Preload
 }
 
 type UserSolvedPuzzle struct {
 	ID            uint      `gorm:"primaryKey" json:"id"`
-	UserID        uint      `gorm:"uniqueIndex" json:"user_id"` // One row per user
-	SolvedPuzzles uint      `json:"solved_puzzles"`
+	UserID        uint      `gorm:"uniqueIndex" json:"user_id"`  // One row per user
+	SolvedPuzzles uint      `gorm:"index" json:"solved_puzzles"` // Indexed for leaderboards
 	TotalPuzzles  uint      `json:"total_puzzles"`
 	CurrentStreak uint      `json:"current_streak"`
-	BestStreak    uint      `json:"best_streak"`
-	LastSolvedAt  time.Time `json:"last_solved_at"`
+	BestStreak    uint      `gorm:"index" json:"best_streak"`
+	StreakFreezes uint      `json:"streak_freezes"` // Each covers one missed day
+	LastSolvedAt  time.Time `gorm:"index" json:"last_solved_at"`
+
+	// Last solve that counted toward the streak; in daily-only mode other
+	// solves leave it alone
+	StreakDayAt time.Time `gorm:"index" json:"streak_day_at"`
+}
+
+// Attempt records every answer submission, right or wrong
+type Attempt struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"index" json:"user_id"`
+	PuzzleID  uint      `gorm:"index" json:"puzzle_id"`
+	Answer    string    `json:"answer"` // As submitted; left empty for correct answers so solutions never leak
+	Correct   bool      `json:"correct"`
+	LatencyMs *int64    `json:"latency_ms"` // Time since the user first opened the puzzle
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
+
+// PuzzleOpen records when a user first opened a puzzle
+type PuzzleOpen struct {
+	ID       uint      `gorm:"primaryKey" json:"id"`
+	UserID   uint      `gorm:"uniqueIndex:idx_puzzle_opens_user_puzzle" json:"user_id"`
+	PuzzleID uint      `gorm:"uniqueIndex:idx_puzzle_opens_user_puzzle" json:"puzzle_id"`
+	OpenedAt time.Time `json:"opened_at"`
+}
+
+// UserHint records a hint a user has unlocked. HintIndex is zero-based.
+type UserHint struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	UserID     uint      `gorm:"uniqueIndex:idx_user_hints_user_puzzle_hint" json:"user_id"`
+	PuzzleID   uint      `gorm:"uniqueIndex:idx_user_hints_user_puzzle_hint" json:"puzzle_id"`
+	HintIndex  int       `gorm:"uniqueIndex:idx_user_hints_user_puzzle_hint" json:"hint_index"`
+	UnlockedAt time.Time `json:"unlocked_at"`
+}
+
+// Room is an escape room: an ordered set of puzzles played against the clock
+type Room struct {
+	ID          uint           `gorm:"primaryKey" json:"id"`
+	Title       string         `json:"title"`
+	Description string         `json:"description"`
+	TimeLimit   int            `json:"time_limit_seconds"` // 0 means untimed
+	Difficulty  string         `gorm:"default:medium" json:"difficulty"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"` // Soft delete
+	Puzzles     []Puzzle       `gorm:"foreignKey:RoomID" json:"-"`
+}
+
+// RoomSession is created when a user starts a room. The server owns its clock:
+// Deadline moves back by the length of every pause.
+type RoomSession struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	RoomID    uint       `gorm:"index" json:"room_id"`
+	UserID    uint       `gorm:"index" json:"user_id"` // Who started it
+	TeamID    *uint      `gorm:"index" json:"team_id"` // nil for solo sessions
+	Status    string     `gorm:"index;default:active" json:"status"`
+	StartedAt time.Time  `json:"started_at"`
+	Deadline  *time.Time `gorm:"index" json:"deadline"` // nil for untimed rooms
+	PausedAt  *time.Time `json:"paused_at"`
+	EndedAt   *time.Time `gorm:"index" json:"ended_at"`
+
+	// Total time spent paused, so completion times only count play time
+	PausedSeconds int64 `json:"paused_seconds"`
+}
+
+// PuzzlePrerequisite says PuzzleID stays locked until PrerequisiteID is solved
+type PuzzlePrerequisite struct {
+	PuzzleID       uint `gorm:"primaryKey" json:"puzzle_id"`
+	PrerequisiteID uint `gorm:"primaryKey;index" json:"prerequisite_id"`
+}
+
+type Team struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"unique" json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TeamMember links a user to their team. A user belongs to at most one team.
+type TeamMember struct {
+	ID       uint      `gorm:"primaryKey" json:"id"`
+	TeamID   uint      `gorm:"index" json:"team_id"`
+	UserID   uint      `gorm:"uniqueIndex" json:"user_id"`
+	Role     string    `gorm:"default:member" json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+	User     User      `gorm:"foreignKey:UserID" json:"-"` // For Preload
+}
+
+type TeamInvite struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	TeamID      uint       `gorm:"index" json:"team_id"`
+	UserID      uint       `gorm:"index" json:"user_id"` // Invitee
+	InvitedBy   uint       `json:"invited_by"`
+	Status      string     `gorm:"default:pending" json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	RespondedAt *time.Time `json:"responded_at"`
+	Team        Team       `gorm:"foreignKey:TeamID" json:"-"` // For Preload
+}
+
+// Achievement is a badge definition. Rows are synced from the rules declared
+// in the achievements package; Kind, Subject and Threshold form the rule.
+type Achievement struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Code        string    `gorm:"uniqueIndex" json:"code"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Kind        string    `json:"kind"`
+	Subject     string    `json:"subject,omitempty"`
+	Threshold   int64     `json:"threshold"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// UserAchievement records when a user unlocked a badge
+type UserAchievement struct {
+	ID            uint        `gorm:"primaryKey" json:"id"`
+	UserID        uint        `gorm:"uniqueIndex:idx_user_achievements_user_achievement" json:"user_id"`
+	AchievementID uint        `gorm:"uniqueIndex:idx_user_achievements_user_achievement" json:"achievement_id"`
+	UnlockedAt    time.Time   `json:"unlocked_at"`
+	Achievement   Achievement `gorm:"foreignKey:AchievementID" json:"-"` // For Preload
+}
+
+// DailyPuzzle schedules the puzzle of the day. Date is a calendar day; each
+// player gets the entry for today in their own time zone.
+type DailyPuzzle struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Date      time.Time `gorm:"type:date;uniqueIndex" json:"date"`
+	PuzzleID  uint      `gorm:"index" json:"puzzle_id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Puzzle    Puzzle    `gorm:"foreignKey:PuzzleID" json:"-"` // For Preload
+}
+
+// ScoringConfig is the points formula, kept in a single row so admins can
+// tune it without a deploy. Changes only affect later solves.
+type ScoringConfig struct {
+	ID               uint    `gorm:"primaryKey" json:"-"`
+	BasePoints       int     `json:"base_points"` // Scaled by the puzzle's difficulty multiplier
+	EasyMultiplier   float64 `json:"easy_multiplier"`
+	MediumMultiplier float64 `json:"medium_multiplier"`
+	HardMultiplier   float64 `json:"hard_multiplier"`
+	HintPenalty      int     `json:"hint_penalty"`    // Per hint unlocked
+	AttemptPenalty   int     `json:"attempt_penalty"` // Per wrong answer before the solve
+
+	// Time penalty per whole minute past the grace period, capped
+	TimeGraceSeconds     int `json:"time_grace_seconds"`
+	TimePenaltyPerMinute int `json:"time_penalty_per_minute"`
+	MaxTimePenalty       int `json:"max_time_penalty"`
+
+	MinPoints int       `json:"min_points"` // Floor for any solve
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ReviewCard schedules a solved puzzle for spaced-repetition review (SM-2).
+// Cards exist only for players who opted in to review mode.
+type ReviewCard struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	UserID         uint       `gorm:"uniqueIndex:idx_review_cards_user_puzzle;index:idx_review_cards_user_due,priority:1" json:"user_id"`
+	PuzzleID       uint       `gorm:"uniqueIndex:idx_review_cards_user_puzzle" json:"puzzle_id"`
+	Repetitions    int        `json:"repetitions"`   // Correct reviews in a row
+	IntervalDays   int        `json:"interval_days"` // Gap before the next review
+	EaseFactor     float64    `gorm:"default:2.5" json:"ease_factor"`
+	DueAt          time.Time  `gorm:"index:idx_review_cards_user_due,priority:2" json:"due_at"`
+	LastReviewedAt *time.Time `json:"last_reviewed_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// Review records one review answer. Reviews are kept apart from Attempt and
+// never count as solves.
+type Review struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	UserID     uint      `gorm:"index" json:"user_id"`
+	PuzzleID   uint      `gorm:"index" json:"puzzle_id"`
+	Correct    bool      `json:"correct"`
+	Quality    int       `json:"quality"` // SM-2 grade from 0 to 5
+	ReviewedAt time.Time `gorm:"index" json:"reviewed_at"`
+}
+
+// RefreshToken is stored as a SHA-256 hash. Each login starts a family; every
+// refresh rotates to a new token in the same family, and presenting a token
+// that was already used revokes the whole family.
+type RefreshToken struct {
+	ID              uint       `gorm:"primaryKey" json:"id"`
+	UserID          uint       `gorm:"index" json:"user_id"`
+	FamilyID        string     `gorm:"index" json:"family_id"`
+	TokenHash       string     `gorm:"uniqueIndex" json:"-"`
+	AccessJTI       string     `gorm:"index" json:"-"` // The access token issued alongside, revoked with the family
+	AccessExpiresAt time.Time  `json:"-"`
+	ExpiresAt       time.Time  `gorm:"index" json:"expires_at"`
+	UsedAt          *time.Time `json:"used_at"`    // Set once rotated
+	RevokedAt       *time.Time `json:"revoked_at"` // Set on logout or reuse
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// RevokedToken denies an access token by its jti until it would have expired anyway
+type RevokedToken struct {
+	JTI       string    `gorm:"primaryKey" json:"jti"`
+	UserID    uint      `gorm:"index" json:"user_id"`
+	ExpiresAt time.Time `gorm:"index" json:"expires_at"`
+	RevokedAt time.Time `json:"revoked_at"`
+}
+
+// ActionToken tracks a signed account action token, such as an email
+// verification or password reset link, so each one works only once
+type ActionToken struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	JTI       string     `gorm:"uniqueIndex" json:"-"`
+	UserID    uint       `gorm:"index" json:"user_id"`
+	Action    string     `json:"action"`
+	ExpiresAt time.Time  `gorm:"index" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"` // Also set when a newer token for the same action replaces it
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// ExportJob builds a personal data export in the background when it is too
+// large to send in one response. The zip lives on disk until ExpiresAt.
+type ExportJob struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	UserID      uint       `gorm:"index" json:"user_id"`
+	Status      string     `gorm:"index" json:"status"`
+	SizeBytes   int64      `json:"size_bytes"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+	ExpiresAt   time.Time  `gorm:"index" json:"expires_at"`
 }
@@ -0,0 +1,53 @@
+package puzzle
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/FieldPs/escape-room-backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// recordOpen stores the first time a user opens a puzzle. Later opens are ignored.
+func recordOpen(db *gorm.DB, userID uint, puzzleID uint) error {
+	return db.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.PuzzleOpen{
+		UserID:   userID,
+		PuzzleID: puzzleID,
+		OpenedAt: time.Now(),
+	}).Error
+}
+
+// newAttempt builds the attempt row for a submission made at the given time
+func newAttempt(db *gorm.DB, userID uint, puzzleID uint, answer string, correct bool, at time.Time) (*models.Attempt, error) {
+	attempt := &models.Attempt{
+		UserID:    userID,
+		PuzzleID:  puzzleID,
+		Correct:   correct,
+		CreatedAt: at,
+	}
+	// Wrong answers are kept as typed: on an exact puzzle, one that differs
+	// from the solution only by case or spacing would normalize into it
+	if !correct {
+		attempt.Answer = answer
+	}
+
+	var open models.PuzzleOpen
+	err := db.Where("user_id = ? AND puzzle_id = ?", userID, puzzleID).First(&open).Error
+	switch {
+	case err == nil:
+		latency := at.Sub(open.OpenedAt).Milliseconds()
+		attempt.LatencyMs = &latency
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, fmt.Errorf("failed to get puzzle open time: %w", err)
+	}
+	return attempt, nil
+}
+
+func recordAttempt(db *gorm.DB, attempt *models.Attempt) error {
+	if err := db.Create(attempt).Error; err != nil {
+		return fmt.Errorf("failed to record attempt: %w", err)
+	}
+	return nil
+}
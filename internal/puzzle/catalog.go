@@ -0,0 +1,256 @@
+package puzzle
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/FieldPs/escape-room-backend/internal/models"
+	"github.com/FieldPs/escape-room-backend/internal/rating"
+	"github.com/FieldPs/escape-room-backend/internal/team"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+var ErrPuzzleNotFound = errors.New("puzzle not found")
+
+// ListOptions controls paging, filtering and ordering of the puzzle catalog
+type ListOptions struct {
+	Page      int
+	PageSize  int
+	Subjects  []string // Match puzzles tagged with any of these subjects
+	RoomID    *uint    // Only puzzles in this room
+	Ascending bool     // Sort by created_at oldest first
+}
+
+// PuzzleView is the public shape of a puzzle. It deliberately copies fields
+// instead of embedding models.Puzzle so the solution can never leak.
+type PuzzleView struct {
+	ID         uint           `json:"id"`
+	Title      string         `json:"title"`
+	Content    string         `json:"content"`
+	Subjects   pq.StringArray `json:"subjects"`
+	MatchMode  string         `json:"match_mode"`
+	Difficulty string         `json:"difficulty"`
+	HintCount  int            `json:"hint_count"`
+
+	// Measured from player answers; SolveChance is the caller's expected chance to solve it
+	Rating          int     `json:"rating"`
+	RatingDeviation int     `json:"rating_deviation"`
+	SolveChance     float64 `json:"solve_chance"`
+
+	RoomID    *uint     `json:"room_id"`
+	Position  int       `json:"room_position"`
+	CreatedAt time.Time `json:"created_at"`
+	Solved    bool      `json:"solved"`
+	Locked    bool      `json:"locked"` // Prerequisites not yet solved
+
+	// Only filled in for single-puzzle responses
+	UnlockedHints []string `json:"unlocked_hints,omitempty"`
+}
+
+type PuzzleListResponse struct {
+	Puzzles  []PuzzleView `json:"puzzles"`
+	Page     int          `json:"page"`
+	PageSize int          `json:"page_size"`
+	Total    int64        `json:"total"`
+}
+
+func ListPuzzles(db *gorm.DB, userID uint, opts ListOptions) (*PuzzleListResponse, error) {
+	opts = normalizeListOptions(opts)
+
+	query := db.Model(&models.Puzzle{}).Scopes(models.Published(time.Now()))
+	if len(opts.Subjects) > 0 {
+		query = query.Where("subjects && ?", pq.StringArray(opts.Subjects))
+	}
+	if opts.RoomID != nil {
+		query = query.Where("room_id = ?", *opts.RoomID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, fmt.Errorf("failed to count puzzles: %w", err)
+	}
+
+	order := "created_at DESC, id DESC"
+	if opts.Ascending {
+		order = "created_at ASC, id ASC"
+	}
+
+	var puzzles []models.Puzzle
+	if err := query.Order(order).
+		Offset((opts.Page - 1) * opts.PageSize).
+		Limit(opts.PageSize).
+		Find(&puzzles).Error; err != nil {
+		return nil, fmt.Errorf("failed to list puzzles: %w", err)
+	}
+
+	views, err := Views(db, userID, puzzles)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PuzzleListResponse{
+		Puzzles:  views,
+		Page:     opts.Page,
+		PageSize: opts.PageSize,
+		Total:    total,
+	}, nil
+}
+
+// Views builds the user's view of each puzzle, in the given order
+func Views(db *gorm.DB, userID uint, puzzles []models.Puzzle) ([]PuzzleView, error) {
+	solved, err := solvedPuzzleIDs(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	locked, err := lockedPuzzles(db, puzzleIDs(puzzles), solved)
+	if err != nil {
+		return nil, err
+	}
+	player, err := rating.ForUser(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	views := make([]PuzzleView, 0, len(puzzles))
+	for _, p := range puzzles {
+		views = append(views, newPuzzleView(p, player, solved[p.ID], locked[p.ID]))
+	}
+	return views, nil
+}
+
+func GetPuzzle(db *gorm.DB, userID uint, puzzleID uint) (*PuzzleView, error) {
+	p, err := getPublishedPuzzle(db, puzzleID)
+	if err != nil {
+		return nil, err
+	}
+
+	solved, err := solvedPuzzleIDs(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	locked, err := lockedPuzzles(db, []uint{p.ID}, solved)
+	if err != nil {
+		return nil, err
+	}
+	player, err := rating.ForUser(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Start the clock used for attempt latency
+	if err := recordOpen(db, userID, p.ID); err != nil {
+		return nil, fmt.Errorf("failed to record puzzle open: %w", err)
+	}
+
+	view := newPuzzleView(*p, player, solved[p.ID], locked[p.ID])
+	if view.UnlockedHints, err = unlockedHints(db, userID, p); err != nil {
+		return nil, err
+	}
+	return &view, nil
+}
+
+func getPuzzle(db *gorm.DB, puzzleID uint) (*models.Puzzle, error) {
+	var p models.Puzzle
+	if err := db.First(&p, puzzleID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPuzzleNotFound
+		}
+		return nil, fmt.Errorf("failed to get puzzle: %w", err)
+	}
+	return &p, nil
+}
+
+// getPublishedPuzzle is getPuzzle for players: scheduled and expired puzzles
+// are reported as not found
+func getPublishedPuzzle(db *gorm.DB, puzzleID uint) (*models.Puzzle, error) {
+	return getPuzzle(db.Scopes(models.Published(time.Now())), puzzleID)
+}
+
+func newPuzzleView(p models.Puzzle, player rating.Rating, solved bool, locked bool) PuzzleView {
+	puzzleRating := rating.OfPuzzle(p)
+	shown := puzzleRating.View()
+	return PuzzleView{
+		ID:              p.ID,
+		Title:           p.Title,
+		Content:         p.Content,
+		Subjects:        p.Subjects,
+		MatchMode:       p.MatchMode,
+		Difficulty:      p.Difficulty,
+		HintCount:       len(p.Hints),
+		Rating:          shown.Rating,
+		RatingDeviation: shown.Deviation,
+		SolveChance:     math.Round(rating.Expected(player, puzzleRating)*100) / 100,
+		RoomID:          p.RoomID,
+		Position:        p.RoomPosition,
+		CreatedAt:       p.CreatedAt,
+		Solved:          solved,
+		Locked:          locked,
+	}
+}
+
+func normalizeListOptions(opts ListOptions) ListOptions {
+	if opts.Page < 1 {
+		opts.Page = 1
+	}
+	if opts.PageSize < 1 {
+		opts.PageSize = DefaultPageSize
+	}
+	if opts.PageSize > MaxPageSize {
+		opts.PageSize = MaxPageSize
+	}
+	return opts
+}
+
+func puzzleIDs(puzzles []models.Puzzle) []uint {
+	ids := make([]uint, 0, len(puzzles))
+	for _, p := range puzzles {
+		ids = append(ids, p.ID)
+	}
+	return ids
+}
+
+// solvedPuzzleIDs returns the set of puzzles the user has solved, including
+// those solved by their team
+func solvedPuzzleIDs(db *gorm.DB, userID uint) (map[uint]bool, error) {
+	solvedBy, err := solvedScope(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []uint
+	if err := db.Model(&models.UserPuzzle{}).
+		Scopes(solvedBy).
+		Pluck("puzzle_id", &ids).Error; err != nil {
+		return nil, fmt.Errorf("failed to get solved puzzles: %w", err)
+	}
+
+	solved := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		solved[id] = true
+	}
+	return solved, nil
+}
+
+// solvedScope limits a UserPuzzle query to solves that count for the user:
+// their own and any recorded for their current team
+func solvedScope(db *gorm.DB, userID uint) (func(*gorm.DB) *gorm.DB, error) {
+	teamID, err := team.TeamIDOf(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(q *gorm.DB) *gorm.DB {
+		if teamID == nil {
+			return q.Where("user_id = ?", userID)
+		}
+		return q.Where("(user_id = ? OR team_id = ?)", userID, *teamID)
+	}, nil
+}
@@ -0,0 +1,194 @@
+package puzzle
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/FieldPs/escape-room-backend/internal/models"
+	"github.com/FieldPs/escape-room-backend/internal/streak"
+	"github.com/FieldPs/escape-room-backend/internal/validation"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DateLayout is how schedule dates are written
+const DateLayout = "2006-01-02"
+
+const (
+	defaultScheduleDays = 31
+	maxScheduleDays     = 366
+)
+
+var ErrNoDailyPuzzle = errors.New("no daily puzzle scheduled")
+
+// DailyView is today's puzzle for the caller
+type DailyView struct {
+	Date string `json:"date"`
+	PuzzleView
+}
+
+// ScheduleEntry assigns a puzzle to a calendar day
+type ScheduleEntry struct {
+	Date     string `json:"date"`
+	PuzzleID uint   `json:"puzzle_id"`
+	Title    string `json:"title,omitempty"` // Filled in on reads
+}
+
+// GetDaily returns the puzzle scheduled for today in the user's time zone.
+// A scheduled puzzle outside its publish window is not shown.
+func GetDaily(db *gorm.DB, userID uint) (*DailyView, error) {
+	policy, err := streak.ForUser(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	today := policy.Date(time.Now()).Format(DateLayout)
+
+	var daily models.DailyPuzzle
+	if err := db.Where("date = ?", today).First(&daily).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNoDailyPuzzle
+		}
+		return nil, fmt.Errorf("failed to get daily puzzle: %w", err)
+	}
+
+	view, err := GetPuzzle(db, userID, daily.PuzzleID)
+	if errors.Is(err, ErrPuzzleNotFound) {
+		return nil, ErrNoDailyPuzzle
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &DailyView{Date: today, PuzzleView: *view}, nil
+}
+
+// isDaily reports whether the puzzle is the daily puzzle on the day of at,
+// as the policy's time zone sees it
+func isDaily(db *gorm.DB, policy streak.Policy, puzzleID uint, at time.Time) (bool, error) {
+	var count int64
+	if err := db.Model(&models.DailyPuzzle{}).
+		Where("date = ? AND puzzle_id = ?", policy.Date(at).Format(DateLayout), puzzleID).
+		Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to check daily puzzle: %w", err)
+	}
+	return count > 0, nil
+}
+
+// ScheduleDaily assigns puzzles to days, replacing what was scheduled on them
+func ScheduleDaily(db *gorm.DB, entries []ScheduleEntry) ([]ScheduleEntry, error) {
+	if len(entries) == 0 {
+		return nil, &validation.Error{Field: "entries", Message: "must contain at least one entry"}
+	}
+
+	rows := make([]models.DailyPuzzle, 0, len(entries))
+	seen := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		date, err := parseDate("date", e.Date)
+		if err != nil {
+			return nil, err
+		}
+		if seen[e.Date] {
+			return nil, &validation.Error{Field: "date", Message: fmt.Sprintf("%s is scheduled twice", e.Date)}
+		}
+		seen[e.Date] = true
+
+		if _, err := getPuzzle(db, e.PuzzleID); err != nil {
+			if errors.Is(err, ErrPuzzleNotFound) {
+				return nil, &validation.Error{Field: "puzzle_id", Message: fmt.Sprintf("puzzle %d not found", e.PuzzleID)}
+			}
+			return nil, err
+		}
+		rows = append(rows, models.DailyPuzzle{Date: date, PuzzleID: e.PuzzleID})
+	}
+
+	if err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "date"}},
+		DoUpdates: clause.AssignmentColumns([]string{"puzzle_id", "updated_at"}),
+	}).Create(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to schedule daily puzzles: %w", err)
+	}
+
+	first, last := rows[0].Date, rows[0].Date
+	for _, row := range rows {
+		if row.Date.Before(first) {
+			first = row.Date
+		}
+		if row.Date.After(last) {
+			last = row.Date
+		}
+	}
+	return listSchedule(db, first, last)
+}
+
+// GetSchedule lists scheduled days from from to to inclusive. from defaults
+// to today (UTC) and to defaults to a month after from.
+func GetSchedule(db *gorm.DB, from, to string) ([]ScheduleEntry, error) {
+	start := streak.PolicyFor(streak.DefaultTimeZone).Date(time.Now())
+	if from != "" {
+		var err error
+		if start, err = parseDate("from", from); err != nil {
+			return nil, err
+		}
+	}
+
+	end := start.AddDate(0, 0, defaultScheduleDays-1)
+	if to != "" {
+		var err error
+		if end, err = parseDate("to", to); err != nil {
+			return nil, err
+		}
+	}
+
+	if end.Before(start) {
+		return nil, &validation.Error{Field: "to", Message: "must not be before from"}
+	}
+	if end.Sub(start) >= maxScheduleDays*24*time.Hour {
+		return nil, &validation.Error{Field: "to", Message: fmt.Sprintf("range must be at most %d days", maxScheduleDays)}
+	}
+	return listSchedule(db, start, end)
+}
+
+// UnscheduleDaily clears the puzzle scheduled on a day
+func UnscheduleDaily(db *gorm.DB, date string) error {
+	day, err := parseDate("date", date)
+	if err != nil {
+		return err
+	}
+
+	result := db.Where("date = ?", day.Format(DateLayout)).Delete(&models.DailyPuzzle{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to unschedule daily puzzle: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNoDailyPuzzle
+	}
+	return nil
+}
+
+func listSchedule(db *gorm.DB, from, to time.Time) ([]ScheduleEntry, error) {
+	var rows []models.DailyPuzzle
+	if err := db.Preload("Puzzle", func(q *gorm.DB) *gorm.DB { return q.Unscoped() }).
+		Where("date BETWEEN ? AND ?", from.Format(DateLayout), to.Format(DateLayout)).
+		Order("date").
+		Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to get daily schedule: %w", err)
+	}
+
+	entries := make([]ScheduleEntry, 0, len(rows))
+	for _, row := range rows {
+		entries = append(entries, ScheduleEntry{
+			Date:     row.Date.Format(DateLayout),
+			PuzzleID: row.PuzzleID,
+			Title:    row.Puzzle.Title,
+		})
+	}
+	return entries, nil
+}
+
+func parseDate(field, value string) (time.Time, error) {
+	date, err := time.Parse(DateLayout, value)
+	if err != nil {
+		return time.Time{}, &validation.Error{Field: field, Message: "must be a date like 2025-01-31"}
+	}
+	return date, nil
+}
@@ -0,0 +1,89 @@
+package puzzle
+
+import (
+	"time"
+
+	"github.com/FieldPs/escape-room-backend/internal/achievements"
+	"github.com/FieldPs/escape-room-backend/internal/events"
+	"github.com/FieldPs/escape-room-backend/internal/models"
+	"github.com/FieldPs/escape-room-backend/internal/room"
+)
+
+// SolvedEvent is the payload of a puzzle.solved event
+type SolvedEvent struct {
+	PuzzleID    uint   `json:"puzzle_id"`
+	Title       string `json:"title"`
+	RoomID      *uint  `json:"room_id,omitempty"`
+	Score       int    `json:"score"`
+	HintsUsed   int    `json:"hints_used"`
+	RoomEscaped bool   `json:"room_escaped,omitempty"`
+}
+
+// HintEvent is the payload of a hint.unlocked event. The hint text is left
+// out: teammates pay for their own hints.
+type HintEvent struct {
+	PuzzleID   uint `json:"puzzle_id"`
+	HintNumber int  `json:"hint_number"`
+	HintsTotal int  `json:"hints_total"`
+}
+
+// publishSolve announces a committed solve, and the end of the session when
+// it was the room's last puzzle
+func publishSolve(userID uint, p *models.Puzzle, session *models.RoomSession, res *AnswerResponse, teamBadges map[uint][]achievements.Badge) {
+	ev := events.Event{
+		Type:   events.PuzzleSolved,
+		UserID: userID,
+		Data: SolvedEvent{
+			PuzzleID:    p.ID,
+			Title:       p.Title,
+			RoomID:      p.RoomID,
+			Score:       res.Score,
+			HintsUsed:   res.HintsUsed,
+			RoomEscaped: res.RoomEscaped,
+		},
+		At: res.SolvedAt,
+	}
+	if session != nil {
+		ev.TeamID = session.TeamID
+		ev.SessionID = &session.ID
+	}
+	events.Publish(ev)
+
+	publishBadges(userID, ev.TeamID, res.Achievements, res.SolvedAt)
+	for memberID, badges := range teamBadges {
+		publishBadges(memberID, ev.TeamID, badges, res.SolvedAt)
+	}
+
+	if res.RoomEscaped {
+		room.PublishSession(userID, session)
+	}
+}
+
+func publishBadges(userID uint, teamID *uint, badges []achievements.Badge, at time.Time) {
+	for _, badge := range badges {
+		events.Publish(events.Event{
+			Type:   events.BadgeUnlocked,
+			UserID: userID,
+			TeamID: teamID,
+			Data:   badge,
+			At:     at,
+		})
+	}
+}
+
+func publishHint(userID uint, session *models.RoomSession, res *HintResponse) {
+	ev := events.Event{
+		Type:   events.HintUnlocked,
+		UserID: userID,
+		Data: HintEvent{
+			PuzzleID:   res.PuzzleID,
+			HintNumber: res.HintNumber,
+			HintsTotal: res.HintsTotal,
+		},
+	}
+	if session != nil {
+		ev.TeamID = session.TeamID
+		ev.SessionID = &session.ID
+	}
+	events.Publish(ev)
+}
@@ -0,0 +1,85 @@
+package puzzle
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/FieldPs/escape-room-backend/internal/models"
+	"gorm.io/gorm"
+)
+
+var ErrNoMoreHints = errors.New("no more hints available")
+
+type HintResponse struct {
+	PuzzleID   uint   `json:"puzzle_id"`
+	HintNumber int    `json:"hint_number"` // 1-based position of this hint
+	Hint       string `json:"hint"`
+	HintsUsed  int    `json:"hints_used"`
+	HintsTotal int    `json:"hints_total"`
+}
+
+// UnlockHint reveals the next hint of a puzzle for the user
+func UnlockHint(db *gorm.DB, userID uint, puzzleID uint) (*HintResponse, error) {
+	p, err := getPublishedPuzzle(db, puzzleID)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := checkAccess(db, userID, p)
+	if err != nil {
+		return nil, err
+	}
+
+	// Asking for a hint means the puzzle is open, even if its page never loaded
+	if err := recordOpen(db, userID, p.ID); err != nil {
+		return nil, fmt.Errorf("failed to record puzzle open: %w", err)
+	}
+
+	used, err := hintsUsed(db, userID, puzzleID)
+	if err != nil {
+		return nil, err
+	}
+	if used >= len(p.Hints) {
+		return nil, ErrNoMoreHints
+	}
+
+	// The unique index on (user, puzzle, index) rejects a concurrent double unlock
+	if err := db.Create(&models.UserHint{
+		UserID:     userID,
+		PuzzleID:   puzzleID,
+		HintIndex:  used,
+		UnlockedAt: time.Now(),
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to unlock hint: %w", err)
+	}
+
+	res := &HintResponse{
+		PuzzleID:   puzzleID,
+		HintNumber: used + 1,
+		Hint:       p.Hints[used],
+		HintsUsed:  used + 1,
+		HintsTotal: len(p.Hints),
+	}
+	publishHint(userID, session, res)
+	return res, nil
+}
+
+// unlockedHints returns the hints of a puzzle the user has already unlocked, in order
+func unlockedHints(db *gorm.DB, userID uint, p *models.Puzzle) ([]string, error) {
+	used, err := hintsUsed(db, userID, p.ID)
+	if err != nil {
+		return nil, err
+	}
+	return p.Hints[:min(used, len(p.Hints))], nil
+}
+
+func hintsUsed(db *gorm.DB, userID uint, puzzleID uint) (int, error) {
+	var count int64
+	if err := db.Model(&models.UserHint{}).
+		Where("user_id = ? AND puzzle_id = ?", userID, puzzleID).
+		Count(&count).Error; err != nil {
+		return 0, fmt.Errorf("failed to count hints: %w", err)
+	}
+	return int(count), nil
+}
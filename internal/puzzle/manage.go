@@ -0,0 +1,275 @@
+package puzzle
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/FieldPs/escape-room-backend/internal/models"
+	"github.com/FieldPs/escape-room-backend/internal/room"
+	"github.com/FieldPs/escape-room-backend/internal/validation"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+// PuzzleInput is the payload admins send to create or replace a puzzle
+type PuzzleInput struct {
+	Title    string   `json:"title"`
+	Content  string   `json:"content"`
+	Solution string   `json:"solution"`
+	Subjects []string `json:"subjects"`
+
+	// Scales the points a solve is worth; defaults to medium
+	Difficulty string `json:"difficulty"`
+
+	// Answer matching; MatchMode defaults to exact
+	MatchMode    string   `json:"match_mode"`
+	Tolerance    float64  `json:"tolerance"`
+	Alternatives []string `json:"alternatives"`
+
+	// Hints are revealed to players in this order
+	Hints []string `json:"hints"`
+
+	// Optional room membership; puzzles without a room are free-play
+	RoomID       *uint `json:"room_id"`
+	RoomPosition int   `json:"room_position"`
+
+	// Optional publish window; players only see the puzzle inside it
+	PublishAt   *time.Time `json:"publish_at"`
+	UnpublishAt *time.Time `json:"unpublish_at"`
+}
+
+// Validate trims the input and checks every field
+func (in *PuzzleInput) Validate() error {
+	in.Title = strings.TrimSpace(in.Title)
+	in.Content = strings.TrimSpace(in.Content)
+
+	if in.Title == "" {
+		return &validation.Error{Field: "title", Message: "must not be empty"}
+	}
+	if strings.TrimSpace(in.Solution) == "" {
+		return &validation.Error{Field: "solution", Message: "must not be empty"}
+	}
+	if len(in.Subjects) == 0 {
+		return &validation.Error{Field: "subjects", Message: "must contain at least one subject"}
+	}
+
+	seen := make(map[string]bool, len(in.Subjects))
+	for i, subject := range in.Subjects {
+		subject = strings.TrimSpace(subject)
+		if !slices.Contains(models.Subjects, subject) {
+			return &validation.Error{
+				Field:   "subjects",
+				Message: fmt.Sprintf("unknown subject %q, expected one of %s", subject, strings.Join(models.Subjects, ", ")),
+			}
+		}
+		if seen[subject] {
+			return &validation.Error{Field: "subjects", Message: fmt.Sprintf("duplicate subject %q", subject)}
+		}
+		seen[subject] = true
+		in.Subjects[i] = subject
+	}
+
+	if in.Difficulty == "" {
+		in.Difficulty = models.DifficultyMedium
+	}
+	if !slices.Contains(room.Difficulties, in.Difficulty) {
+		return &validation.Error{
+			Field:   "difficulty",
+			Message: fmt.Sprintf("unknown difficulty %q, expected one of %s", in.Difficulty, strings.Join(room.Difficulties, ", ")),
+		}
+	}
+
+	if in.RoomPosition < 0 {
+		return &validation.Error{Field: "room_position", Message: "must not be negative"}
+	}
+
+	if in.PublishAt != nil && in.UnpublishAt != nil && !in.UnpublishAt.After(*in.PublishAt) {
+		return &validation.Error{Field: "unpublish_at", Message: "must be after publish_at"}
+	}
+
+	for i, hint := range in.Hints {
+		if in.Hints[i] = strings.TrimSpace(hint); in.Hints[i] == "" {
+			return &validation.Error{Field: "hints", Message: "must not contain empty hints"}
+		}
+	}
+
+	return in.validateMatching()
+}
+
+// validateMatching checks that the solution makes sense for the match mode
+func (in *PuzzleInput) validateMatching() error {
+	if in.MatchMode == "" {
+		in.MatchMode = models.MatchExact
+	}
+	if !slices.Contains(MatchModes, in.MatchMode) {
+		return &validation.Error{
+			Field:   "match_mode",
+			Message: fmt.Sprintf("unknown mode %q, expected one of %s", in.MatchMode, strings.Join(MatchModes, ", ")),
+		}
+	}
+
+	if in.Tolerance != 0 && in.MatchMode != models.MatchNumeric {
+		return &validation.Error{Field: "tolerance", Message: "only allowed with numeric match mode"}
+	}
+	if len(in.Alternatives) > 0 && in.MatchMode != models.MatchAlternatives {
+		return &validation.Error{Field: "alternatives", Message: "only allowed with alternatives match mode"}
+	}
+
+	if usesHash(in.MatchMode) && len(hashInput(in.MatchMode, in.Solution)) > maxHashedSolutionLen {
+		return &validation.Error{
+			Field:   "solution",
+			Message: fmt.Sprintf("must be at most %d bytes for %s match mode", maxHashedSolutionLen, in.MatchMode),
+		}
+	}
+
+	switch in.MatchMode {
+	case models.MatchNumeric:
+		if _, err := parseNumber(in.Solution); err != nil {
+			return &validation.Error{Field: "solution", Message: "must be a number for numeric match mode"}
+		}
+		if in.Tolerance < 0 || math.IsNaN(in.Tolerance) || math.IsInf(in.Tolerance, 0) {
+			return &validation.Error{Field: "tolerance", Message: "must be a finite, non-negative number"}
+		}
+	case models.MatchRegex:
+		if _, err := compileSolutionPattern(in.Solution); err != nil {
+			return &validation.Error{Field: "solution", Message: "invalid regular expression: " + err.Error()}
+		}
+	case models.MatchAlternatives:
+		if len(in.Alternatives) == 0 {
+			return &validation.Error{Field: "alternatives", Message: "must contain at least one alternative"}
+		}
+		for _, alt := range in.Alternatives {
+			if strings.TrimSpace(alt) == "" {
+				return &validation.Error{Field: "alternatives", Message: "must not contain empty answers"}
+			}
+		}
+	}
+	return nil
+}
+
+// validateRoom checks that the referenced room exists
+func (in *PuzzleInput) validateRoom(db *gorm.DB) error {
+	if in.RoomID == nil {
+		return nil
+	}
+
+	var count int64
+	if err := db.Model(&models.Room{}).Where("id = ?", *in.RoomID).Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to check room: %w", err)
+	}
+	if count == 0 {
+		return &validation.Error{Field: "room_id", Message: "room not found"}
+	}
+	return nil
+}
+
+// apply copies validated input onto a puzzle model and seals the solution
+func (in *PuzzleInput) apply(p *models.Puzzle) error {
+	p.Title = in.Title
+	p.Content = in.Content
+	p.Solution = in.Solution
+	p.Subjects = pq.StringArray(in.Subjects)
+	p.Difficulty = in.Difficulty
+	p.MatchMode = in.MatchMode
+	p.Tolerance = in.Tolerance
+	p.Alternatives = pq.StringArray(in.Alternatives)
+	p.Hints = pq.StringArray(in.Hints)
+	p.RoomID = in.RoomID
+	p.RoomPosition = in.RoomPosition
+	p.PublishAt = in.PublishAt
+	p.UnpublishAt = in.UnpublishAt
+	return SealSolution(p)
+}
+
+func CreatePuzzle(db *gorm.DB, in PuzzleInput) (*models.Puzzle, error) {
+	if err := in.Validate(); err != nil {
+		return nil, err
+	}
+	if err := in.validateRoom(db); err != nil {
+		return nil, err
+	}
+
+	var p models.Puzzle
+	if err := in.apply(&p); err != nil {
+		return nil, err
+	}
+	if err := db.Create(&p).Error; err != nil {
+		return nil, fmt.Errorf("failed to create puzzle: %w", err)
+	}
+	return &p, nil
+}
+
+func UpdatePuzzle(db *gorm.DB, puzzleID uint, in PuzzleInput) (*models.Puzzle, error) {
+	if err := in.Validate(); err != nil {
+		return nil, err
+	}
+	if err := in.validateRoom(db); err != nil {
+		return nil, err
+	}
+
+	p, err := getPuzzle(db, puzzleID)
+	if err != nil {
+		return nil, err
+	}
+
+	leavesRoom := !sameRoom(p.RoomID, in.RoomID)
+	if err := in.apply(p); err != nil {
+		return nil, err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(p).Error; err != nil {
+			return fmt.Errorf("failed to update puzzle: %w", err)
+		}
+		// Prerequisites only make sense inside one room
+		if leavesRoom {
+			return clearPrerequisites(tx, p.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// DeletePuzzle soft-deletes a puzzle. Solves that reference it are kept.
+func DeletePuzzle(db *gorm.DB, puzzleID uint) error {
+	result := db.Delete(&models.Puzzle{}, puzzleID)
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete puzzle: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrPuzzleNotFound
+	}
+	return nil
+}
+
+// RestorePuzzle undoes a soft delete
+func RestorePuzzle(db *gorm.DB, puzzleID uint) (*models.Puzzle, error) {
+	result := db.Unscoped().Model(&models.Puzzle{}).
+		Where("id = ? AND deleted_at IS NOT NULL", puzzleID).
+		Update("deleted_at", nil)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to restore puzzle: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrPuzzleNotFound
+	}
+
+	var p models.Puzzle
+	if err := db.First(&p, puzzleID).Error; err != nil {
+		return nil, fmt.Errorf("failed to get puzzle: %w", err)
+	}
+	return &p, nil
+}
+
+func sameRoom(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
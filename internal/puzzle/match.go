@@ -0,0 +1,168 @@
+package puzzle
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/FieldPs/escape-room-backend/internal/auth"
+	"github.com/FieldPs/escape-room-backend/internal/models"
+	"github.com/lib/pq"
+)
+
+// MatchModes lists every supported answer matching mode
+var MatchModes = []string{
+	models.MatchExact,
+	models.MatchCaseInsensitive,
+	models.MatchNumeric,
+	models.MatchRegex,
+	models.MatchAlternatives,
+}
+
+// normalizeAnswer trims, case-folds and collapses inner whitespace
+func normalizeAnswer(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
+
+// maxHashedSolutionLen is bcrypt's input limit
+const maxHashedSolutionLen = 72
+
+// usesHash reports whether a mode can be checked against a one-way hash
+func usesHash(mode string) bool {
+	return mode == models.MatchExact || mode == models.MatchCaseInsensitive || mode == ""
+}
+
+// hashInput is the form of an answer that gets hashed for the given mode
+func hashInput(mode, answer string) string {
+	if mode == models.MatchCaseInsensitive {
+		return normalizeAnswer(answer)
+	}
+	return answer
+}
+
+// SealSolution replaces the plaintext Solution and Alternatives with their
+// stored forms: a bcrypt hash for hash-checkable modes, AES-GCM ciphertext
+// for modes that must compare against the plaintext.
+func SealSolution(p *models.Puzzle) error {
+	p.SolutionHash = ""
+	p.SolutionCipher = ""
+
+	if usesHash(p.MatchMode) {
+		hash, err := auth.HashPassword(hashInput(p.MatchMode, p.Solution))
+		if err != nil {
+			return fmt.Errorf("failed to hash solution: %w", err)
+		}
+		p.SolutionHash = hash
+	} else {
+		sealed, err := auth.Encrypt(p.Solution)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt solution: %w", err)
+		}
+		p.SolutionCipher = sealed
+	}
+
+	alternatives := make(pq.StringArray, 0, len(p.Alternatives))
+	for _, alt := range p.Alternatives {
+		sealed, err := auth.Encrypt(alt)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt alternative: %w", err)
+		}
+		alternatives = append(alternatives, sealed)
+	}
+	p.Alternatives = alternatives
+	p.Solution = ""
+	return nil
+}
+
+// openSolution decrypts the stored solution and alternatives of a puzzle
+// whose mode needs the plaintext
+func openSolution(p *models.Puzzle) error {
+	solution, err := auth.Decrypt(p.SolutionCipher)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt solution of puzzle %d: %w", p.ID, err)
+	}
+	p.Solution = solution
+
+	for i, alt := range p.Alternatives {
+		if p.Alternatives[i], err = auth.Decrypt(alt); err != nil {
+			return fmt.Errorf("failed to decrypt alternative of puzzle %d: %w", p.ID, err)
+		}
+	}
+	return nil
+}
+
+// matchAnswer applies the puzzle's matching mode to a submitted answer.
+// The puzzle must be in its stored (sealed) form.
+func matchAnswer(p *models.Puzzle, answer string) (bool, error) {
+	if usesHash(p.MatchMode) {
+		input := hashInput(p.MatchMode, answer)
+		if len(input) > maxHashedSolutionLen {
+			return false, nil // Longer than any stored solution
+		}
+		return auth.CheckPasswordHash(input, p.SolutionHash), nil
+	}
+
+	opened := *p
+	opened.Alternatives = append(pq.StringArray(nil), p.Alternatives...)
+	if err := openSolution(&opened); err != nil {
+		return false, err
+	}
+	return matchPlaintext(&opened, answer)
+}
+
+// matchPlaintext compares an answer against an opened solution
+func matchPlaintext(p *models.Puzzle, answer string) (bool, error) {
+	switch p.MatchMode {
+	case models.MatchExact, "":
+		return answer == p.Solution, nil
+
+	case models.MatchCaseInsensitive:
+		return normalizeAnswer(answer) == normalizeAnswer(p.Solution), nil
+
+	case models.MatchNumeric:
+		want, err := parseNumber(p.Solution)
+		if err != nil {
+			return false, fmt.Errorf("puzzle %d has a non-numeric solution: %w", p.ID, err)
+		}
+		got, err := parseNumber(answer)
+		if err != nil {
+			return false, nil // Not a number, so simply wrong
+		}
+		return math.Abs(got-want) <= p.Tolerance, nil
+
+	case models.MatchRegex:
+		re, err := compileSolutionPattern(p.Solution)
+		if err != nil {
+			return false, fmt.Errorf("puzzle %d has an invalid pattern: %w", p.ID, err)
+		}
+		return re.MatchString(strings.TrimSpace(answer)), nil
+
+	case models.MatchAlternatives:
+		got := normalizeAnswer(answer)
+		if got == normalizeAnswer(p.Solution) {
+			return true, nil
+		}
+		for _, alt := range p.Alternatives {
+			if got == normalizeAnswer(alt) {
+				return true, nil
+			}
+		}
+		return false, nil
+
+	default:
+		return false, fmt.Errorf("puzzle %d has unknown match mode %q", p.ID, p.MatchMode)
+	}
+}
+
+// parseNumber accepts plain numbers with optional thousands separators
+func parseNumber(s string) (float64, error) {
+	s = strings.ReplaceAll(strings.TrimSpace(s), ",", "")
+	return strconv.ParseFloat(s, 64)
+}
+
+// compileSolutionPattern anchors the pattern so it must match the whole answer
+func compileSolutionPattern(pattern string) (*regexp.Regexp, error) {
+	return regexp.Compile(`^(?:` + pattern + `)$`)
+}
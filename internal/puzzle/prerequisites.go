@@ -0,0 +1,156 @@
+package puzzle
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/FieldPs/escape-room-backend/internal/models"
+	"github.com/FieldPs/escape-room-backend/internal/validation"
+	"gorm.io/gorm"
+)
+
+var ErrPuzzleLocked = errors.New("puzzle is locked until its prerequisites are solved")
+
+// GetPrerequisites returns the IDs of the puzzles that unlock a puzzle
+func GetPrerequisites(db *gorm.DB, puzzleID uint) ([]uint, error) {
+	if _, err := getPuzzle(db, puzzleID); err != nil {
+		return nil, err
+	}
+
+	ids := []uint{}
+	if err := db.Model(&models.PuzzlePrerequisite{}).
+		Where("puzzle_id = ?", puzzleID).
+		Order("prerequisite_id").
+		Pluck("prerequisite_id", &ids).Error; err != nil {
+		return nil, fmt.Errorf("failed to get prerequisites: %w", err)
+	}
+	return ids, nil
+}
+
+// SetPrerequisites replaces a puzzle's prerequisites. Every prerequisite must
+// be in the same room, and the resulting graph must stay acyclic.
+func SetPrerequisites(db *gorm.DB, puzzleID uint, prerequisiteIDs []uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		p, err := getPuzzle(tx, puzzleID)
+		if err != nil {
+			return err
+		}
+		if p.RoomID == nil && len(prerequisiteIDs) > 0 {
+			return &validation.Error{Field: "prerequisite_ids", Message: "only puzzles in a room can have prerequisites"}
+		}
+
+		seen := make(map[uint]bool, len(prerequisiteIDs))
+		for _, id := range prerequisiteIDs {
+			if id == puzzleID {
+				return &validation.Error{Field: "prerequisite_ids", Message: "a puzzle cannot require itself"}
+			}
+			if seen[id] {
+				return &validation.Error{Field: "prerequisite_ids", Message: fmt.Sprintf("duplicate puzzle %d", id)}
+			}
+			seen[id] = true
+
+			var count int64
+			if err := tx.Model(&models.Puzzle{}).
+				Where("id = ? AND room_id = ?", id, *p.RoomID).
+				Count(&count).Error; err != nil {
+				return fmt.Errorf("failed to check prerequisite: %w", err)
+			}
+			if count == 0 {
+				return &validation.Error{
+					Field:   "prerequisite_ids",
+					Message: fmt.Sprintf("puzzle %d does not exist in the same room", id),
+				}
+			}
+		}
+
+		if len(prerequisiteIDs) > 0 {
+			if err := checkAcyclic(tx, *p.RoomID, puzzleID, prerequisiteIDs); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Where("puzzle_id = ?", puzzleID).Delete(&models.PuzzlePrerequisite{}).Error; err != nil {
+			return fmt.Errorf("failed to clear prerequisites: %w", err)
+		}
+		for _, id := range prerequisiteIDs {
+			if err := tx.Create(&models.PuzzlePrerequisite{PuzzleID: puzzleID, PrerequisiteID: id}).Error; err != nil {
+				return fmt.Errorf("failed to save prerequisite: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// checkAcyclic rejects the new edges if any prerequisite already depends,
+// directly or transitively, on the puzzle itself
+func checkAcyclic(db *gorm.DB, roomID uint, puzzleID uint, prerequisiteIDs []uint) error {
+	var edges []models.PuzzlePrerequisite
+	if err := db.Joins("JOIN puzzles ON puzzles.id = puzzle_prerequisites.puzzle_id").
+		Where("puzzles.room_id = ? AND puzzle_prerequisites.puzzle_id <> ?", roomID, puzzleID).
+		Find(&edges).Error; err != nil {
+		return fmt.Errorf("failed to load prerequisite graph: %w", err)
+	}
+
+	requires := make(map[uint][]uint)
+	for _, e := range edges {
+		requires[e.PuzzleID] = append(requires[e.PuzzleID], e.PrerequisiteID)
+	}
+
+	if createsCycle(requires, puzzleID, prerequisiteIDs) {
+		return &validation.Error{Field: "prerequisite_ids", Message: "prerequisites would create a cycle"}
+	}
+	return nil
+}
+
+// createsCycle walks prerequisites depth-first looking for the puzzle being
+// edited. requires maps each other puzzle to its prerequisites.
+func createsCycle(requires map[uint][]uint, puzzleID uint, prerequisiteIDs []uint) bool {
+	visited := make(map[uint]bool)
+	stack := append([]uint(nil), prerequisiteIDs...)
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if id == puzzleID {
+			return true
+		}
+		if visited[id] {
+			continue
+		}
+		visited[id] = true
+		stack = append(stack, requires[id]...)
+	}
+	return false
+}
+
+// clearPrerequisites removes every edge touching a puzzle, used when it leaves its room
+func clearPrerequisites(db *gorm.DB, puzzleID uint) error {
+	if err := db.Where("puzzle_id = ? OR prerequisite_id = ?", puzzleID, puzzleID).
+		Delete(&models.PuzzlePrerequisite{}).Error; err != nil {
+		return fmt.Errorf("failed to clear prerequisites: %w", err)
+	}
+	return nil
+}
+
+// lockedPuzzles returns the subset of puzzleIDs with at least one unsolved
+// prerequisite. Soft-deleted prerequisites are ignored so they can't lock
+// a puzzle forever.
+func lockedPuzzles(db *gorm.DB, puzzleIDs []uint, solved map[uint]bool) (map[uint]bool, error) {
+	locked := make(map[uint]bool)
+	if len(puzzleIDs) == 0 {
+		return locked, nil
+	}
+
+	var edges []models.PuzzlePrerequisite
+	if err := db.Joins("JOIN puzzles ON puzzles.id = puzzle_prerequisites.prerequisite_id AND puzzles.deleted_at IS NULL").
+		Where("puzzle_prerequisites.puzzle_id IN ?", puzzleIDs).
+		Find(&edges).Error; err != nil {
+		return nil, fmt.Errorf("failed to get prerequisites: %w", err)
+	}
+
+	for _, e := range edges {
+		if !solved[e.PrerequisiteID] {
+			locked[e.PuzzleID] = true
+		}
+	}
+	return locked, nil
+}
@@ -0,0 +1,29 @@
+package puzzle
+
+import "testing"
+
+func TestCreatesCycle(t *testing.T) {
+	tests := []struct {
+		name          string
+		requires      map[uint][]uint
+		puzzleID      uint
+		prerequisites []uint
+		want          bool
+	}{
+		{"no prerequisites", nil, 1, nil, false},
+		{"requires itself", nil, 1, []uint{1}, true},
+		{"unrelated puzzle", map[uint][]uint{2: {3}}, 1, []uint{2}, false},
+		{"direct cycle", map[uint][]uint{2: {1}}, 1, []uint{2}, true},
+		{"transitive cycle", map[uint][]uint{2: {3}, 3: {4}, 4: {1}}, 1, []uint{2}, true},
+		{"cycle through a later prerequisite", map[uint][]uint{3: {1}}, 1, []uint{2, 3}, true},
+		{"diamond without cycle", map[uint][]uint{2: {4}, 3: {4}, 4: {5}}, 1, []uint{2, 3}, false},
+		{"existing cycle elsewhere", map[uint][]uint{2: {3}, 3: {2}}, 1, []uint{2}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := createsCycle(tt.requires, tt.puzzleID, tt.prerequisites); got != tt.want {
+				t.Errorf("createsCycle() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,11 +1,16 @@
 package puzzle
 
 import (
-	"errors"
 	"fmt"
 	"time"
 
+	"github.com/FieldPs/escape-room-backend/internal/achievements"
 	"github.com/FieldPs/escape-room-backend/internal/models"
+	"github.com/FieldPs/escape-room-backend/internal/rating"
+	"github.com/FieldPs/escape-room-backend/internal/review"
+	"github.com/FieldPs/escape-room-backend/internal/room"
+	"github.com/FieldPs/escape-room-backend/internal/scoring"
+	"github.com/FieldPs/escape-room-backend/internal/streak"
 	"gorm.io/gorm"
 )
 
@@ -20,35 +25,80 @@ type AnswerResponse struct {
 	CurrentStreak uint      `json:"current_streak,omitempty"`
 	BestStreak    uint      `json:"best_streak,omitempty"`
 	SolvedAt      time.Time `json:"solved_at,omitempty"`
+	HintsUsed     int       `json:"hints_used"`
+	Score         int       `json:"score,omitempty"`
+	RoomEscaped   bool      `json:"room_escaped,omitempty"` // This solve finished the room
+	Rating        int       `json:"rating,omitempty"`       // The user's skill rating after this answer
+
+	// How the score was reached
+	ScoreBreakdown *scoring.Breakdown `json:"score_breakdown,omitempty"`
+
+	// Badges this solve unlocked
+	Achievements []achievements.Badge `json:"achievements,omitempty"`
 }
 
 func CheckAnswer(db *gorm.DB, userID uint, req AnswerRequest) (*AnswerResponse, error) {
 	// Verify puzzle exists and get solution
-	var p models.Puzzle
-	if err := db.First(&p, req.PuzzleID).Error; err != nil {
-		return nil, errors.New("puzzle not found")
+	p, err := getPublishedPuzzle(db, req.PuzzleID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Room puzzles need a running session and solved prerequisites
+	session, err := checkAccess(db, userID, p)
+	if err != nil {
+		return nil, err
+	}
+
+	// Apply the puzzle's matching mode
+	correct, err := matchAnswer(p, req.Answer)
+	if err != nil {
+		return nil, err
 	}
-	fmt.Println("Puzzle ID:", p.ID, "Solution:", p.Solution)
+
 	// Initialize response
 	res := &AnswerResponse{
-		Correct: req.Answer == p.Solution,
+		Correct: correct,
 		Message: "Incorrect answer",
 	}
 
+	// Every submission is recorded for analytics
+	attempt, err := newAttempt(db, userID, p.ID, req.Answer, correct, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	// A first submission without opening the puzzle starts the clock for the next
+	if err := recordOpen(db, userID, p.ID); err != nil {
+		return nil, fmt.Errorf("failed to record puzzle open: %w", err)
+	}
+
 	// Check if already solved
-	if exists, err := alreadySolved(db, userID, req.PuzzleID); err != nil {
+	exists, err := alreadySolved(db, userID, req.PuzzleID)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.HintsUsed, err = hintsUsed(db, userID, req.PuzzleID); err != nil {
 		return nil, err
-	} else if exists {
+	}
+
+	if exists {
+		if err := recordAttempt(db, attempt); err != nil {
+			return nil, err
+		}
 		res.Message = "Already solved"
 		return res, nil
 	}
-
 	if !res.Correct {
+		if err := recordFailure(db, userID, p.ID, attempt, res); err != nil {
+			return nil, err
+		}
 		return res, nil
 	}
 
 	// Process correct answer
-	if err := recordSolve(db, userID, req.PuzzleID, res); err != nil {
+	if err := recordSolve(db, userID, p, session, attempt, res); err != nil {
 		return nil, err
 	}
 
@@ -58,26 +108,89 @@ func CheckAnswer(db *gorm.DB, userID uint, req AnswerRequest) (*AnswerResponse,
 
 // Helper functions
 func alreadySolved(db *gorm.DB, userID uint, puzzleID uint) (bool, error) {
+	solvedBy, err := solvedScope(db, userID)
+	if err != nil {
+		return false, err
+	}
+
 	var count int64
-	err := db.Model(&models.UserPuzzle{}).
-		Where("user_id = ? AND puzzle_id = ?", userID, puzzleID).
+	err = db.Model(&models.UserPuzzle{}).
+		Scopes(solvedBy).
+		Where("puzzle_id = ?", puzzleID).
 		Count(&count).Error
 	return count > 0, err
 }
 
-func recordSolve(db *gorm.DB, userID uint, puzzleID uint, res *AnswerResponse) error {
-	now := time.Now()
-
+// recordFailure stores a wrong answer and counts it as a loss against the puzzle
+func recordFailure(db *gorm.DB, userID uint, puzzleID uint, attempt *models.Attempt, res *AnswerResponse) error {
 	return db.Transaction(func(tx *gorm.DB) error {
+		if err := recordAttempt(tx, attempt); err != nil {
+			return err
+		}
+		player, err := rating.Record(tx, userID, puzzleID, false)
+		if err != nil {
+			return err
+		}
+		res.Rating = player.View().Rating
+		return nil
+	})
+}
+
+func recordSolve(db *gorm.DB, userID uint, p *models.Puzzle, session *models.RoomSession, attempt *models.Attempt, res *AnswerResponse) error {
+	now := attempt.CreatedAt
+	puzzleID := p.ID
+	var teamBadges map[uint][]achievements.Badge
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := recordAttempt(tx, attempt); err != nil {
+			return err
+		}
+
+		// Score the solve with the current formula
+		breakdown, err := scoreSolve(tx, userID, p, res.HintsUsed, attempt)
+		if err != nil {
+			return err
+		}
+
 		// Create solve record
+		// Solves in a team session count for every member
+		var teamID, sessionID *uint
+		if session != nil {
+			teamID = session.TeamID
+			sessionID = &session.ID
+		}
+
 		if err := tx.Create(&models.UserPuzzle{
-			UserID:   userID,
-			PuzzleID: puzzleID,
-			SolvedAt: now,
+			UserID:    userID,
+			TeamID:    teamID,
+			SessionID: sessionID,
+			PuzzleID:  puzzleID,
+			SolvedAt:  now,
+			HintsUsed: res.HintsUsed,
+			Score:     breakdown.Total,
 		}).Error; err != nil {
 			return err
 		}
 
+		// Players in review mode see the puzzle again on a schedule
+		if err := review.Enqueue(tx, userID, puzzleID, now); err != nil {
+			return err
+		}
+
+		// Solving the last puzzle of a room ends the session as escaped
+		if session != nil {
+			escaped, err := roomCompleted(tx, userID, *p.RoomID)
+			if err != nil {
+				return err
+			}
+			if escaped {
+				if err := room.EndSession(tx, session, models.SessionEscaped); err != nil {
+					return err
+				}
+				res.RoomEscaped = true
+			}
+		}
+
 		// 2. Get or create the user's stats record
 		var stats models.UserSolvedPuzzle
 		result := tx.Where(models.UserSolvedPuzzle{UserID: userID}).Attrs(models.UserSolvedPuzzle{
@@ -93,51 +206,132 @@ func recordSolve(db *gorm.DB, userID uint, puzzleID uint, res *AnswerResponse) e
 
 		// 3. Get total puzzles count
 		var totalPuzzles int64
-		if err := tx.Model(&models.Puzzle{}).Count(&totalPuzzles).Error; err != nil {
+		if err := tx.Model(&models.Puzzle{}).Scopes(models.Published(now)).Count(&totalPuzzles).Error; err != nil {
 			return fmt.Errorf("failed to count puzzles: %w", err)
 		}
 
-		// Calculate streak
-		stats.CurrentStreak = calculateStreak(stats.LastSolvedAt, now, stats.CurrentStreak)
-		if stats.CurrentStreak > stats.BestStreak {
-			stats.BestStreak = stats.CurrentStreak
+		// 4. Advance the streak using the user's own day boundaries. In
+		// daily-only mode only today's daily puzzle keeps the streak going.
+		policy, err := streak.ForUser(tx, userID)
+		if err != nil {
+			return err
+		}
+		counts := true
+		if streak.DailyOnly() {
+			if counts, err = isDaily(tx, policy, puzzleID, now); err != nil {
+				return err
+			}
+		}
+		if counts {
+			state := policy.Record(streak.FromStats(stats), now)
+			stats.CurrentStreak = state.Current
+			stats.BestStreak = state.Best
+			stats.StreakFreezes = state.Freezes
+			stats.StreakDayAt = state.DayAt
 		}
 
 		// 5. Update all stats
 		stats.SolvedPuzzles++
-		stats.TotalPuzzles = uint(totalPuzzles) // Update with current total
 		stats.LastSolvedAt = now
+		stats.TotalPuzzles = uint(totalPuzzles) // Update with current total
 
-		// 6. Save the updated stats
-		if err := tx.Model(&stats).Updates(models.UserSolvedPuzzle{
-			SolvedPuzzles: stats.SolvedPuzzles,
-			TotalPuzzles:  stats.TotalPuzzles,
-			CurrentStreak: stats.CurrentStreak,
-			BestStreak:    stats.BestStreak,
-			LastSolvedAt:  stats.LastSolvedAt,
-		}).Error; err != nil {
+		// 6. Save the updated stats; freezes may drop to zero, so select columns explicitly
+		if err := tx.Model(&stats).
+			Select("solved_puzzles", "total_puzzles", "current_streak", "best_streak", "streak_freezes", "last_solved_at", "streak_day_at").
+			Updates(models.UserSolvedPuzzle{
+				SolvedPuzzles: stats.SolvedPuzzles,
+				TotalPuzzles:  stats.TotalPuzzles,
+				CurrentStreak: stats.CurrentStreak,
+				BestStreak:    stats.BestStreak,
+				StreakFreezes: stats.StreakFreezes,
+				LastSolvedAt:  stats.LastSolvedAt,
+				StreakDayAt:   stats.StreakDayAt,
+			}).Error; err != nil {
 			return fmt.Errorf("failed to update UserSolvedPuzzle: %w", err)
 		}
 
-		// 7. Set response values
+		// 7. A solve is a win against the puzzle
+		player, err := rating.Record(tx, userID, puzzleID, true)
+		if err != nil {
+			return err
+		}
+
+		// 8. Unlock any badges the solve earned
+		badges, err := achievements.Evaluate(tx, userID)
+		if err != nil {
+			return err
+		}
+		res.Achievements = badges
+
+		// A team escape counts for every member, so their badges are checked too
+		if res.RoomEscaped && teamID != nil {
+			if teamBadges, err = evaluateTeammates(tx, userID, *teamID); err != nil {
+				return err
+			}
+		}
+
+		// 9. Set response values
 		res.CurrentStreak = stats.CurrentStreak
 		res.BestStreak = stats.BestStreak
 		res.SolvedAt = now
+		res.Score = breakdown.Total
+		res.Rating = player.View().Rating
+		res.ScoreBreakdown = &breakdown
 
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+
+	// Teammates and session watchers only hear about committed solves
+	publishSolve(userID, p, session, res, teamBadges)
+	return nil
 }
 
-func calculateStreak(lastSolved time.Time, current time.Time, currentStreak uint) uint {
-	if lastSolved.IsZero() {
-		return 1
+// evaluateTeammates unlocks the badges the team's other members earned and
+// returns them by user
+func evaluateTeammates(tx *gorm.DB, userID uint, teamID uint) (map[uint][]achievements.Badge, error) {
+	var memberIDs []uint
+	if err := tx.Model(&models.TeamMember{}).
+		Where("team_id = ? AND user_id <> ?", teamID, userID).
+		Order("user_id").
+		Pluck("user_id", &memberIDs).Error; err != nil {
+		return nil, fmt.Errorf("failed to get team members: %w", err)
+	}
+
+	unlocked := make(map[uint][]achievements.Badge)
+	for _, memberID := range memberIDs {
+		badges, err := achievements.Evaluate(tx, memberID)
+		if err != nil {
+			return nil, err
+		}
+		if len(badges) > 0 {
+			unlocked[memberID] = badges
+		}
 	}
+	return unlocked, nil
+}
 
-	lastDay := lastSolved.Truncate(24 * time.Hour)
-	currentDay := current.Truncate(24 * time.Hour)
+// scoreSolve applies the scoring formula to a correct answer. Wrong answers
+// the user gave to the puzzle before this one each cost points.
+func scoreSolve(tx *gorm.DB, userID uint, p *models.Puzzle, hintsUsed int, attempt *models.Attempt) (scoring.Breakdown, error) {
+	cfg, err := scoring.Get(tx)
+	if err != nil {
+		return scoring.Breakdown{}, err
+	}
 
-	if lastDay.Add(24 * time.Hour).Equal(currentDay) {
-		return currentStreak + 1
+	var wrong int64
+	if err := tx.Model(&models.Attempt{}).
+		Where("user_id = ? AND puzzle_id = ? AND correct = ?", userID, p.ID, false).
+		Count(&wrong).Error; err != nil {
+		return scoring.Breakdown{}, fmt.Errorf("failed to count wrong attempts: %w", err)
 	}
-	return 1
+
+	return scoring.Compute(cfg, scoring.Solve{
+		Difficulty:    p.Difficulty,
+		HintsUsed:     hintsUsed,
+		WrongAttempts: wrong,
+		LatencyMs:     attempt.LatencyMs,
+	}), nil
 }
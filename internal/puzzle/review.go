@@ -0,0 +1,138 @@
+package puzzle
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/FieldPs/escape-room-backend/internal/models"
+	"github.com/FieldPs/escape-room-backend/internal/review"
+	"gorm.io/gorm"
+)
+
+type ReviewRequest struct {
+	Answer  string `json:"answer" binding:"required"`
+	Quality int    `json:"quality"` // How easy a correct answer felt, 3 to 5; defaults to 4
+}
+
+type ReviewResponse struct {
+	Correct      bool      `json:"correct"`
+	Message      string    `json:"message"`
+	Quality      int       `json:"quality"`
+	Repetitions  int       `json:"repetitions"`
+	IntervalDays int       `json:"interval_days"`
+	NextDueAt    time.Time `json:"next_due_at"`
+}
+
+// DueReview is a solved puzzle waiting to be reviewed
+type DueReview struct {
+	Puzzle       PuzzleView `json:"puzzle"`
+	DueAt        time.Time  `json:"due_at"`
+	Repetitions  int        `json:"repetitions"`
+	IntervalDays int        `json:"interval_days"`
+}
+
+type DueReviewsResponse struct {
+	Enabled bool        `json:"enabled"` // False until the user opts in to review mode
+	Reviews []DueReview `json:"reviews"`
+}
+
+// GetDueReviews lists the user's reviews that are due, most overdue first
+func GetDueReviews(db *gorm.DB, userID uint, limit int) (*DueReviewsResponse, error) {
+	if limit < 1 {
+		limit = DefaultPageSize
+	}
+	limit = min(limit, MaxPageSize)
+
+	res := &DueReviewsResponse{Reviews: []DueReview{}}
+	enabled, err := review.Enabled(db, userID)
+	if err != nil || !enabled {
+		return res, err
+	}
+	res.Enabled = true
+
+	now := time.Now()
+	cards, err := review.Due(db, userID, now, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint, 0, len(cards))
+	for _, card := range cards {
+		ids = append(ids, card.PuzzleID)
+	}
+
+	// Deleted and unpublished puzzles stay queued but are not shown
+	var puzzles []models.Puzzle
+	if err := db.Scopes(models.Published(now)).Where("id IN ?", ids).Find(&puzzles).Error; err != nil {
+		return nil, fmt.Errorf("failed to get review puzzles: %w", err)
+	}
+	views, err := Views(db, userID, puzzles)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]PuzzleView, len(views))
+	for _, v := range views {
+		byID[v.ID] = v
+	}
+
+	for _, card := range cards {
+		view, ok := byID[card.PuzzleID]
+		if !ok {
+			continue
+		}
+		res.Reviews = append(res.Reviews, DueReview{
+			Puzzle:       view,
+			DueAt:        card.DueAt,
+			Repetitions:  card.Repetitions,
+			IntervalDays: card.IntervalDays,
+		})
+	}
+	return res, nil
+}
+
+// SubmitReview checks a review answer and reschedules the puzzle. Reviews do
+// not count as attempts or solves and leave scores and ratings alone.
+func SubmitReview(db *gorm.DB, userID uint, puzzleID uint, req ReviewRequest) (*ReviewResponse, error) {
+	enabled, err := review.Enabled(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		return nil, review.ErrReviewModeOff
+	}
+
+	if req.Quality == 0 {
+		req.Quality = review.GoodQuality
+	}
+	if err := review.ValidateQuality(req.Quality); err != nil {
+		return nil, err
+	}
+
+	p, err := getPublishedPuzzle(db, puzzleID)
+	if err != nil {
+		return nil, err
+	}
+	correct, err := matchAnswer(p, req.Answer)
+	if err != nil {
+		return nil, err
+	}
+
+	card, err := review.Record(db, userID, puzzleID, correct, req.Quality, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	res := &ReviewResponse{
+		Correct:      correct,
+		Message:      "Correct answer!",
+		Quality:      req.Quality,
+		Repetitions:  card.Repetitions,
+		IntervalDays: card.IntervalDays,
+		NextDueAt:    card.DueAt,
+	}
+	if !correct {
+		res.Message = "Incorrect answer, this puzzle will come back tomorrow"
+		res.Quality = review.WrongQuality
+	}
+	return res, nil
+}
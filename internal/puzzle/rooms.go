@@ -0,0 +1,117 @@
+package puzzle
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/FieldPs/escape-room-backend/internal/models"
+	"github.com/FieldPs/escape-room-backend/internal/rating"
+	"github.com/FieldPs/escape-room-backend/internal/room"
+	"github.com/FieldPs/escape-room-backend/internal/scoring"
+	"gorm.io/gorm"
+)
+
+type RoomProgress struct {
+	RoomID    uint             `json:"room_id"`
+	Session   room.SessionView `json:"session"`
+	Solved    int              `json:"solved"`
+	Total     int              `json:"total"`
+	Completed bool             `json:"completed"`
+	Score     int64            `json:"score"` // Points earned in this session, by everyone on the team
+	Puzzles   []PuzzleView     `json:"puzzles"`
+}
+
+// GetRoomProgress lists a started room's puzzles in order with the user's progress
+func GetRoomProgress(db *gorm.DB, userID uint, roomID uint) (*RoomProgress, error) {
+	session, err := room.FindSession(db, userID, roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	var puzzles []models.Puzzle
+	if err := db.Where("room_id = ?", roomID).
+		Scopes(models.Published(time.Now())).
+		Order("room_position, id").
+		Find(&puzzles).Error; err != nil {
+		return nil, fmt.Errorf("failed to get room puzzles: %w", err)
+	}
+
+	solved, err := solvedPuzzleIDs(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	locked, err := lockedPuzzles(db, puzzleIDs(puzzles), solved)
+	if err != nil {
+		return nil, err
+	}
+
+	player, err := rating.ForUser(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	score, err := scoring.SessionTotal(db, session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	progress := &RoomProgress{
+		RoomID:  roomID,
+		Session: room.NewSessionView(*session, time.Now()),
+		Total:   len(puzzles),
+		Score:   score,
+		Puzzles: make([]PuzzleView, 0, len(puzzles)),
+	}
+	for _, p := range puzzles {
+		if solved[p.ID] {
+			progress.Solved++
+		}
+		progress.Puzzles = append(progress.Puzzles, newPuzzleView(p, player, solved[p.ID], locked[p.ID]))
+	}
+	progress.Completed = progress.Total > 0 && progress.Solved == progress.Total
+	return progress, nil
+}
+
+// checkAccess rejects play on puzzles in a room without a running session and
+// on puzzles whose prerequisites are unsolved. It returns the session for room
+// puzzles and nil for free-play ones.
+func checkAccess(db *gorm.DB, userID uint, p *models.Puzzle) (*models.RoomSession, error) {
+	if p.RoomID == nil {
+		return nil, nil
+	}
+	session, err := room.ActiveSession(db, userID, *p.RoomID)
+	if err != nil {
+		return nil, err
+	}
+
+	solved, err := solvedPuzzleIDs(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	locked, err := lockedPuzzles(db, []uint{p.ID}, solved)
+	if err != nil {
+		return nil, err
+	}
+	if locked[p.ID] {
+		return nil, ErrPuzzleLocked
+	}
+	return session, nil
+}
+
+// roomCompleted reports whether every puzzle in a room is solved for the
+// user, counting their team's solves
+func roomCompleted(db *gorm.DB, userID uint, roomID uint) (bool, error) {
+	solvedBy, err := solvedScope(db, userID)
+	if err != nil {
+		return false, err
+	}
+
+	var remaining int64
+	if err := db.Model(&models.Puzzle{}).
+		Where("room_id = ?", roomID).
+		Scopes(models.Published(time.Now())).
+		Where("id NOT IN (?)", db.Model(&models.UserPuzzle{}).Select("puzzle_id").Scopes(solvedBy)).
+		Count(&remaining).Error; err != nil {
+		return false, fmt.Errorf("failed to check room completion: %w", err)
+	}
+	return remaining == 0, nil
+}
@@ -0,0 +1,136 @@
+package rating
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/FieldPs/escape-room-backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Every answer is treated as a Glicko game between a player and a puzzle: a
+// solve is a win for the player, a wrong answer a win for the puzzle. Both
+// sides start unrated and become more certain with every game.
+const (
+	DefaultValue     = 1500
+	DefaultDeviation = 350
+
+	// MinDeviation keeps ratings from freezing once they have settled, so a
+	// player who improves or a puzzle whose content changes still moves
+	MinDeviation = 50
+)
+
+// q is the Glicko scale constant ln(10)/400
+var q = math.Ln10 / 400
+
+// Rating is a skill estimate: Value is the rating, Deviation how uncertain it is
+type Rating struct {
+	Value     float64
+	Deviation float64
+}
+
+func Default() Rating {
+	return Rating{Value: DefaultValue, Deviation: DefaultDeviation}
+}
+
+// g damps the effect of an opponent whose rating is uncertain
+func g(deviation float64) float64 {
+	return 1 / math.Sqrt(1+3*q*q*deviation*deviation/(math.Pi*math.Pi))
+}
+
+// Expected is the chance r beats opponent: for a player against a puzzle, the
+// chance they solve it
+func Expected(r, opponent Rating) float64 {
+	return 1 / (1 + math.Pow(10, -g(opponent.Deviation)*(r.Value-opponent.Value)/400))
+}
+
+// Update returns r after one game against opponent, where score is 1 for a
+// win and 0 for a loss
+func (r Rating) Update(opponent Rating, score float64) Rating {
+	gj := g(opponent.Deviation)
+	e := Expected(r, opponent)
+	dInv := q * q * gj * gj * e * (1 - e)
+	precision := 1/(r.Deviation*r.Deviation) + dInv
+
+	return Rating{
+		Value:     r.Value + q/precision*gj*(score-e),
+		Deviation: max(math.Sqrt(1/precision), MinDeviation),
+	}
+}
+
+// Record rates one answer, updating the user and the puzzle together. Call it
+// inside the transaction that records the answer.
+func Record(tx *gorm.DB, userID uint, puzzleID uint, solved bool) (Rating, error) {
+	// Lock the user before the puzzle everywhere so concurrent answers cannot deadlock
+	var user models.User
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id", "rating", "rating_deviation").
+		First(&user, userID).Error; err != nil {
+		return Rating{}, fmt.Errorf("failed to get user rating: %w", err)
+	}
+	var p models.Puzzle
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id", "rating", "rating_deviation").
+		First(&p, puzzleID).Error; err != nil {
+		return Rating{}, fmt.Errorf("failed to get puzzle rating: %w", err)
+	}
+
+	player, puzzle := OfUser(user), OfPuzzle(p)
+	score := 0.0
+	if solved {
+		score = 1
+	}
+	player, puzzle = player.Update(puzzle, score), puzzle.Update(player, 1-score)
+
+	if err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"rating":           player.Value,
+		"rating_deviation": player.Deviation,
+	}).Error; err != nil {
+		return Rating{}, fmt.Errorf("failed to update user rating: %w", err)
+	}
+	// UpdateColumns leaves updated_at alone; a rating change is not an edit
+	if err := tx.Model(&models.Puzzle{}).Where("id = ?", puzzleID).UpdateColumns(map[string]interface{}{
+		"rating":           puzzle.Value,
+		"rating_deviation": puzzle.Deviation,
+	}).Error; err != nil {
+		return Rating{}, fmt.Errorf("failed to update puzzle rating: %w", err)
+	}
+	return player, nil
+}
+
+// ForUser loads a user's rating
+func ForUser(db *gorm.DB, userID uint) (Rating, error) {
+	var user models.User
+	if err := db.Select("id", "rating", "rating_deviation").Where("id = ?", userID).Limit(1).Find(&user).Error; err != nil {
+		return Rating{}, fmt.Errorf("failed to get user rating: %w", err)
+	}
+	return OfUser(user), nil
+}
+
+// OfUser reads the rating off a user row; rows created before ratings existed
+// count as unrated
+func OfUser(u models.User) Rating {
+	return of(u.Rating, u.RatingDeviation)
+}
+
+func OfPuzzle(p models.Puzzle) Rating {
+	return of(p.Rating, p.RatingDeviation)
+}
+
+func of(value, deviation float64) Rating {
+	if deviation <= 0 {
+		return Default()
+	}
+	return Rating{Value: value, Deviation: deviation}
+}
+
+// View is a rating as shown to players
+type View struct {
+	Rating    int `json:"rating"`
+	Deviation int `json:"rating_deviation"` // Lower means more certain
+}
+
+func (r Rating) View() View {
+	return View{Rating: int(math.Round(r.Value)), Deviation: int(math.Round(r.Deviation))}
+}
@@ -0,0 +1,102 @@
+package rating
+
+import (
+	"math"
+	"testing"
+)
+
+const tolerance = 0.01
+
+func near(got, want float64) bool {
+	return math.Abs(got-want) < tolerance
+}
+
+// The g and expected values are from the worked example in Glickman's
+// description of the Glicko system
+func TestG(t *testing.T) {
+	tests := []struct {
+		deviation float64
+		want      float64
+	}{
+		{30, 0.9955},
+		{100, 0.9531},
+		{300, 0.7242},
+	}
+	for _, tt := range tests {
+		if got := g(tt.deviation); math.Abs(got-tt.want) > 0.0001 {
+			t.Errorf("g(%v) = %.4f, want %.4f", tt.deviation, got, tt.want)
+		}
+	}
+}
+
+func TestExpected(t *testing.T) {
+	tests := []struct {
+		name     string
+		r        Rating
+		opponent Rating
+		want     float64
+	}{
+		{"equal ratings", Default(), Default(), 0.5},
+		{"stronger player", Rating{1500, 200}, Rating{1400, 30}, 0.639},
+		{"weaker player", Rating{1400, 30}, Rating{1500, 30}, 0.360},
+		{"uncertain opponent pulls toward even", Rating{1500, 200}, Rating{1700, 300}, 0.303},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Expected(tt.r, tt.opponent); math.Abs(got-tt.want) > 0.001 {
+				t.Errorf("Expected() = %.4f, want %.4f", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	tests := []struct {
+		name     string
+		r        Rating
+		opponent Rating
+		score    float64
+		want     Rating
+	}{
+		{"unrated win", Default(), Default(), 1, Rating{1662.21, 290.23}},
+		{"unrated loss", Default(), Default(), 0, Rating{1337.79, 290.23}},
+		{"expected win", Rating{1500, 200}, Rating{1400, 30}, 1, Rating{1563.43, 175.22}},
+		{"upset loss", Rating{1500, 200}, Rating{1400, 30}, 0, Rating{1387.49, 175.22}},
+		{"settled rating keeps the minimum deviation", Rating{1500, MinDeviation}, Rating{1500, MinDeviation}, 1, Rating{1506.97, MinDeviation}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.r.Update(tt.opponent, tt.score)
+			if !near(got.Value, tt.want.Value) || !near(got.Deviation, tt.want.Deviation) {
+				t.Errorf("Update() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeviationDecay(t *testing.T) {
+	r, puzzle := Default(), Default()
+	previous := r.Deviation
+	for i := 0; i < 500; i++ {
+		r = r.Update(puzzle, float64(i%2))
+		if r.Deviation > previous {
+			t.Fatalf("game %d: deviation rose from %.2f to %.2f", i+1, previous, r.Deviation)
+		}
+		if r.Deviation < MinDeviation {
+			t.Fatalf("game %d: deviation %.2f is below the minimum", i+1, r.Deviation)
+		}
+		previous = r.Deviation
+	}
+	if r.Deviation != MinDeviation {
+		t.Errorf("after 500 games deviation = %.2f, want %d", r.Deviation, MinDeviation)
+	}
+}
+
+func TestOf(t *testing.T) {
+	if got := of(1700, 0); got != Default() {
+		t.Errorf("of(1700, 0) = %+v, want the default rating", got)
+	}
+	if got := of(1700, 80); got != (Rating{1700, 80}) {
+		t.Errorf("of(1700, 80) = %+v, want {1700 80}", got)
+	}
+}
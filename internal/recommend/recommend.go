@@ -0,0 +1,177 @@
+package recommend
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/FieldPs/escape-room-backend/internal/models"
+	"github.com/FieldPs/escape-room-backend/internal/puzzle"
+	"github.com/FieldPs/escape-room-backend/internal/rating"
+	"github.com/FieldPs/escape-room-backend/internal/stats"
+	"github.com/FieldPs/escape-room-backend/internal/validation"
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultLimit = 10
+	MaxLimit     = 50
+)
+
+// Profile is what strategies know about the player
+type Profile struct {
+	UserID     uint
+	Skill      rating.Rating
+	Subjects   map[string]stats.SubjectStat
+	LastSolved map[string]time.Time // Most recent solve per subject; missing if never solved
+	Now        time.Time
+}
+
+// Strategy ranks candidate puzzles for a player. Rank returns a score, higher
+// first, and a short explanation shown with the suggestion. A candidate with
+// a score of zero or less is left out.
+type Strategy interface {
+	Rank(p *Profile, candidate puzzle.PuzzleView) (score float64, reason string)
+}
+
+// DefaultStrategy is used when the caller does not pick one
+const DefaultStrategy = "weakest_subject"
+
+var strategies = map[string]Strategy{}
+
+// Register makes a strategy available under name, replacing any existing one
+func Register(name string, s Strategy) {
+	strategies[name] = s
+}
+
+// Strategies lists the registered strategy names in order
+func Strategies() []string {
+	names := make([]string, 0, len(strategies))
+	for name := range strategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type Query struct {
+	Strategy string
+	Limit    int
+}
+
+func (q *Query) Validate() error {
+	if q.Strategy == "" {
+		q.Strategy = DefaultStrategy
+	}
+	if q.Limit == 0 {
+		q.Limit = DefaultLimit
+	}
+	if _, ok := strategies[q.Strategy]; !ok {
+		return &validation.Error{Field: "strategy", Message: "must be one of " + strings.Join(Strategies(), ", ")}
+	}
+	if q.Limit < 1 || q.Limit > MaxLimit {
+		return &validation.Error{Field: "limit", Message: fmt.Sprintf("must be between 1 and %d", MaxLimit)}
+	}
+	return nil
+}
+
+type Suggestion struct {
+	Puzzle puzzle.PuzzleView `json:"puzzle"`
+	Reason string            `json:"reason"` // Why this puzzle, e.g. "you're 20% in Chemistry"
+	Score  float64           `json:"score"`  // Strategy-specific; only the order matters
+}
+
+type Response struct {
+	Strategy    string       `json:"strategy"`
+	Suggestions []Suggestion `json:"suggestions"`
+}
+
+// Get suggests unsolved free-play puzzles for the user, best first. Room
+// puzzles are left out because they can only be answered inside a session.
+func Get(db *gorm.DB, userID uint, q Query) (*Response, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+
+	profile, err := loadProfile(db, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	var puzzles []models.Puzzle
+	if err := db.Scopes(models.Published(profile.Now)).
+		Where("room_id IS NULL").
+		Where("id NOT IN (?)", db.Model(&models.UserPuzzle{}).Select("puzzle_id").Where("user_id = ?", userID)).
+		Find(&puzzles).Error; err != nil {
+		return nil, fmt.Errorf("failed to get candidate puzzles: %w", err)
+	}
+
+	// Views also catch team solves and prerequisites
+	views, err := puzzle.Views(db, userID, puzzles)
+	if err != nil {
+		return nil, err
+	}
+
+	strategy := strategies[q.Strategy]
+	res := &Response{Strategy: q.Strategy, Suggestions: []Suggestion{}}
+	for _, v := range views {
+		if v.Solved || v.Locked {
+			continue
+		}
+		score, reason := strategy.Rank(profile, v)
+		if score <= 0 {
+			continue
+		}
+		res.Suggestions = append(res.Suggestions, Suggestion{Puzzle: v, Reason: reason, Score: score})
+	}
+
+	sort.SliceStable(res.Suggestions, func(i, j int) bool {
+		a, b := res.Suggestions[i], res.Suggestions[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		return a.Puzzle.ID < b.Puzzle.ID
+	})
+	if len(res.Suggestions) > q.Limit {
+		res.Suggestions = res.Suggestions[:q.Limit]
+	}
+	return res, nil
+}
+
+func loadProfile(db *gorm.DB, userID uint, now time.Time) (*Profile, error) {
+	skill, err := rating.ForUser(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	subjects, err := stats.GetSubjectStats(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		Subject  string
+		SolvedAt time.Time
+	}
+	if err := db.Model(&models.UserPuzzle{}).
+		Select("s.subject, MAX(user_puzzles.solved_at) AS solved_at").
+		Joins("JOIN puzzles ON puzzles.id = user_puzzles.puzzle_id").
+		Joins("CROSS JOIN LATERAL UNNEST(puzzles.subjects) AS s(subject)").
+		Where("user_puzzles.user_id = ?", userID).
+		Group("s.subject").
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to get solve history: %w", err)
+	}
+	lastSolved := make(map[string]time.Time, len(rows))
+	for _, row := range rows {
+		lastSolved[row.Subject] = row.SolvedAt
+	}
+
+	return &Profile{
+		UserID:     userID,
+		Skill:      skill,
+		Subjects:   subjects,
+		LastSolved: lastSolved,
+		Now:        now,
+	}, nil
+}
@@ -0,0 +1,85 @@
+package recommend
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/FieldPs/escape-room-backend/internal/puzzle"
+)
+
+// TargetChance is the solve chance that makes a puzzle a good stretch: hard
+// enough to teach something, easy enough to finish
+const TargetChance = 0.65
+
+// staleAfter is how long without a solve makes a subject fully stale
+const staleAfter = 30 * 24 * time.Hour
+
+func init() {
+	Register("weakest_subject", WeakestSubject{})
+	Register("skill_match", SkillMatch{})
+	Register("stale_subject", StaleSubject{})
+}
+
+// fit is 1 for a puzzle at TargetChance and falls off linearly either side
+func fit(v puzzle.PuzzleView) float64 {
+	return 1 - math.Abs(v.SolveChance-TargetChance)
+}
+
+func chance(v puzzle.PuzzleView) string {
+	return fmt.Sprintf("about a %.0f%% chance you solve it", v.SolveChance*100)
+}
+
+// WeakestSubject prefers puzzles in the subjects the player has solved the
+// smallest share of, at a suitable difficulty
+type WeakestSubject struct{}
+
+func (WeakestSubject) Rank(p *Profile, v puzzle.PuzzleView) (float64, string) {
+	weakest, percentage := "", 101.0
+	for _, subject := range v.Subjects {
+		if pct := p.Subjects[subject].Percentage; pct < percentage {
+			weakest, percentage = subject, pct
+		}
+	}
+	if weakest == "" {
+		return 0, ""
+	}
+
+	weakness := 1 - percentage/100
+	return weakness * fit(v), fmt.Sprintf("you're %.0f%% in %s; %s", percentage, weakest, chance(v))
+}
+
+// SkillMatch only looks at how well the puzzle's rating suits the player
+type SkillMatch struct{}
+
+func (SkillMatch) Rank(_ *Profile, v puzzle.PuzzleView) (float64, string) {
+	return fit(v), fmt.Sprintf("rated %d, %s", v.Rating, chance(v))
+}
+
+// StaleSubject prefers subjects the player has not solved anything in for the
+// longest, at a suitable difficulty
+type StaleSubject struct{}
+
+func (StaleSubject) Rank(p *Profile, v puzzle.PuzzleView) (float64, string) {
+	stalest, idle, never := "", time.Duration(-1), false
+	for _, subject := range v.Subjects {
+		last, ok := p.LastSolved[subject]
+		if !ok {
+			stalest, never = subject, true
+			break
+		}
+		if d := p.Now.Sub(last); d > idle {
+			stalest, idle = subject, d
+		}
+	}
+	if stalest == "" {
+		return 0, ""
+	}
+
+	if never {
+		return fit(v), fmt.Sprintf("you haven't solved any %s yet; %s", stalest, chance(v))
+	}
+	staleness := min(float64(idle)/float64(staleAfter), 1)
+	days := int(idle.Hours() / 24)
+	return staleness * fit(v), fmt.Sprintf("no %s solves in %d days; %s", stalest, days, chance(v))
+}
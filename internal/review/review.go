@@ -0,0 +1,180 @@
+package review
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/FieldPs/escape-room-backend/internal/models"
+	"github.com/FieldPs/escape-room-backend/internal/validation"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrReviewModeOff = errors.New("review mode is off")
+	ErrNotInReview   = errors.New("puzzle is not in the review queue")
+	ErrReviewNotDue  = errors.New("review is not due yet")
+)
+
+// SM-2 parameters
+const (
+	DefaultEase = 2.5
+	MinEase     = 1.3
+
+	// Grades for a review answer. Wrong answers grade below PassQuality and
+	// restart the schedule; players grade correct ones by how hard they felt.
+	WrongQuality = 1
+	PassQuality  = 3
+	GoodQuality  = 4
+	MaxQuality   = 5
+)
+
+const day = 24 * time.Hour
+
+// Enabled reports whether the user opted in to review mode
+func Enabled(db *gorm.DB, userID uint) (bool, error) {
+	var user models.User
+	if err := db.Select("id", "review_mode").Where("id = ?", userID).Limit(1).Find(&user).Error; err != nil {
+		return false, fmt.Errorf("failed to get review mode: %w", err)
+	}
+	return user.ReviewMode, nil
+}
+
+// SetMode turns review mode on or off. Turning it on queues every puzzle the
+// user already solved; turning it off keeps the queue for next time.
+func SetMode(db *gorm.DB, userID uint, enabled bool) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).
+			Where("id = ?", userID).
+			Update("review_mode", enabled).Error; err != nil {
+			return fmt.Errorf("failed to update review mode: %w", err)
+		}
+		if !enabled {
+			return nil
+		}
+
+		var solves []models.UserPuzzle
+		if err := tx.Select("puzzle_id", "solved_at").Where("user_id = ?", userID).Find(&solves).Error; err != nil {
+			return fmt.Errorf("failed to get solved puzzles: %w", err)
+		}
+		for _, s := range solves {
+			if err := enqueue(tx, userID, s.PuzzleID, s.SolvedAt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Enqueue adds a just-solved puzzle to the review queue of a user in review
+// mode. Call it inside the solve transaction.
+func Enqueue(tx *gorm.DB, userID uint, puzzleID uint, solvedAt time.Time) error {
+	enabled, err := Enabled(tx, userID)
+	if err != nil || !enabled {
+		return err
+	}
+	return enqueue(tx, userID, puzzleID, solvedAt)
+}
+
+// enqueue schedules the first review a day after the solve; cards already
+// queued keep their schedule
+func enqueue(tx *gorm.DB, userID uint, puzzleID uint, solvedAt time.Time) error {
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.ReviewCard{
+		UserID:       userID,
+		PuzzleID:     puzzleID,
+		IntervalDays: 1,
+		EaseFactor:   DefaultEase,
+		DueAt:        solvedAt.Add(day),
+	}).Error; err != nil {
+		return fmt.Errorf("failed to queue review: %w", err)
+	}
+	return nil
+}
+
+// Due returns the user's cards due by now, most overdue first
+func Due(db *gorm.DB, userID uint, now time.Time, limit int) ([]models.ReviewCard, error) {
+	var cards []models.ReviewCard
+	if err := db.Where("user_id = ? AND due_at <= ?", userID, now).
+		Order("due_at, id").
+		Limit(limit).
+		Find(&cards).Error; err != nil {
+		return nil, fmt.Errorf("failed to get due reviews: %w", err)
+	}
+	return cards, nil
+}
+
+// ValidateQuality checks a player's grade for a correct review
+func ValidateQuality(quality int) error {
+	if quality < PassQuality || quality > MaxQuality {
+		return &validation.Error{Field: "quality", Message: fmt.Sprintf("must be between %d and %d", PassQuality, MaxQuality)}
+	}
+	return nil
+}
+
+// Schedule applies one SM-2 step to a card for a review graded quality
+func Schedule(card *models.ReviewCard, quality int, at time.Time) {
+	if quality < PassQuality {
+		card.Repetitions = 0
+		card.IntervalDays = 1
+	} else {
+		card.Repetitions++
+		switch card.Repetitions {
+		case 1:
+			card.IntervalDays = 1
+		case 2:
+			card.IntervalDays = 6
+		default:
+			card.IntervalDays = int(math.Round(float64(card.IntervalDays) * card.EaseFactor))
+		}
+	}
+
+	miss := float64(MaxQuality - quality)
+	card.EaseFactor = max(card.EaseFactor+0.1-miss*(0.08+miss*0.02), MinEase)
+	card.DueAt = at.Add(time.Duration(card.IntervalDays) * day)
+	card.LastReviewedAt = &at
+}
+
+// Record stores a review answer and reschedules the card. Cards can only be
+// reviewed once due, so repeating an answer cannot push the schedule out.
+func Record(db *gorm.DB, userID uint, puzzleID uint, correct bool, quality int, at time.Time) (*models.ReviewCard, error) {
+	if !correct {
+		quality = WrongQuality
+	}
+
+	var card models.ReviewCard
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ? AND puzzle_id = ?", userID, puzzleID).
+			First(&card).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrNotInReview
+			}
+			return fmt.Errorf("failed to get review card: %w", err)
+		}
+		if card.DueAt.After(at) {
+			return ErrReviewNotDue
+		}
+
+		if err := tx.Create(&models.Review{
+			UserID:     userID,
+			PuzzleID:   puzzleID,
+			Correct:    correct,
+			Quality:    quality,
+			ReviewedAt: at,
+		}).Error; err != nil {
+			return fmt.Errorf("failed to record review: %w", err)
+		}
+
+		Schedule(&card, quality, at)
+		if err := tx.Save(&card).Error; err != nil {
+			return fmt.Errorf("failed to reschedule review: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &card, nil
+}
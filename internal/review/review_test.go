@@ -0,0 +1,52 @@
+package review
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/FieldPs/escape-room-backend/internal/models"
+)
+
+func TestSchedule(t *testing.T) {
+	at := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		card         models.ReviewCard
+		quality      int
+		wantReps     int
+		wantInterval int
+		wantEase     float64
+	}{
+		{"first pass", models.ReviewCard{EaseFactor: DefaultEase}, MaxQuality, 1, 1, 2.6},
+		{"second pass", models.ReviewCard{Repetitions: 1, IntervalDays: 1, EaseFactor: DefaultEase}, GoodQuality, 2, 6, 2.5},
+		{"third pass scales by ease", models.ReviewCard{Repetitions: 2, IntervalDays: 6, EaseFactor: DefaultEase}, PassQuality, 3, 15, 2.36},
+		{"interval is rounded", models.ReviewCard{Repetitions: 3, IntervalDays: 10, EaseFactor: 2.36}, MaxQuality, 4, 24, 2.46},
+		{"wrong answer restarts", models.ReviewCard{Repetitions: 5, IntervalDays: 40, EaseFactor: DefaultEase}, WrongQuality, 0, 1, 1.96},
+		{"ease has a floor", models.ReviewCard{Repetitions: 5, IntervalDays: 40, EaseFactor: 1.4}, WrongQuality, 0, 1, MinEase},
+		{"hard pass at the floor", models.ReviewCard{Repetitions: 3, IntervalDays: 10, EaseFactor: MinEase}, PassQuality, 4, 13, MinEase},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			card := tt.card
+			Schedule(&card, tt.quality, at)
+
+			if card.Repetitions != tt.wantReps {
+				t.Errorf("Repetitions = %d, want %d", card.Repetitions, tt.wantReps)
+			}
+			if card.IntervalDays != tt.wantInterval {
+				t.Errorf("IntervalDays = %d, want %d", card.IntervalDays, tt.wantInterval)
+			}
+			if math.Abs(card.EaseFactor-tt.wantEase) > 1e-9 {
+				t.Errorf("EaseFactor = %v, want %v", card.EaseFactor, tt.wantEase)
+			}
+			if want := at.AddDate(0, 0, tt.wantInterval); !card.DueAt.Equal(want) {
+				t.Errorf("DueAt = %v, want %v", card.DueAt, want)
+			}
+			if card.LastReviewedAt == nil || !card.LastReviewedAt.Equal(at) {
+				t.Errorf("LastReviewedAt = %v, want %v", card.LastReviewedAt, at)
+			}
+		})
+	}
+}
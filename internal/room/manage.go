@@ -0,0 +1,94 @@
+package room
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/FieldPs/escape-room-backend/internal/models"
+	"github.com/FieldPs/escape-room-backend/internal/validation"
+	"gorm.io/gorm"
+)
+
+// Difficulties lists the allowed room difficulties
+var Difficulties = []string{models.DifficultyEasy, models.DifficultyMedium, models.DifficultyHard}
+
+// RoomInput is the payload admins send to create or replace a room
+type RoomInput struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	TimeLimit   int    `json:"time_limit_seconds"`
+	Difficulty  string `json:"difficulty"`
+}
+
+// Validate trims the input and checks every field
+func (in *RoomInput) Validate() error {
+	in.Title = strings.TrimSpace(in.Title)
+	in.Description = strings.TrimSpace(in.Description)
+
+	if in.Title == "" {
+		return &validation.Error{Field: "title", Message: "must not be empty"}
+	}
+	if in.TimeLimit < 0 {
+		return &validation.Error{Field: "time_limit_seconds", Message: "must not be negative"}
+	}
+	if in.Difficulty == "" {
+		in.Difficulty = models.DifficultyMedium
+	}
+	if !slices.Contains(Difficulties, in.Difficulty) {
+		return &validation.Error{
+			Field:   "difficulty",
+			Message: fmt.Sprintf("unknown difficulty %q, expected one of %s", in.Difficulty, strings.Join(Difficulties, ", ")),
+		}
+	}
+	return nil
+}
+
+func (in *RoomInput) apply(r *models.Room) {
+	r.Title = in.Title
+	r.Description = in.Description
+	r.TimeLimit = in.TimeLimit
+	r.Difficulty = in.Difficulty
+}
+
+func CreateRoom(db *gorm.DB, in RoomInput) (*models.Room, error) {
+	if err := in.Validate(); err != nil {
+		return nil, err
+	}
+
+	var r models.Room
+	in.apply(&r)
+	if err := db.Create(&r).Error; err != nil {
+		return nil, fmt.Errorf("failed to create room: %w", err)
+	}
+	return &r, nil
+}
+
+func UpdateRoom(db *gorm.DB, roomID uint, in RoomInput) (*models.Room, error) {
+	if err := in.Validate(); err != nil {
+		return nil, err
+	}
+
+	r, err := getRoom(db, roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	in.apply(r)
+	if err := db.Save(r).Error; err != nil {
+		return nil, fmt.Errorf("failed to update room: %w", err)
+	}
+	return r, nil
+}
+
+// DeleteRoom soft-deletes a room. Its puzzles stay attached.
+func DeleteRoom(db *gorm.DB, roomID uint) error {
+	result := db.Delete(&models.Room{}, roomID)
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete room: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrRoomNotFound
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package room
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/FieldPs/escape-room-backend/internal/models"
+	"gorm.io/gorm"
+)
+
+var ErrRoomNotFound = errors.New("room not found")
+
+type RoomView struct {
+	ID          uint      `json:"id"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	TimeLimit   int       `json:"time_limit_seconds"`
+	Difficulty  string    `json:"difficulty"`
+	PuzzleCount int64     `json:"puzzle_count"`
+	Started     bool      `json:"started"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ListRooms returns every room with its puzzle count and whether the user started it
+func ListRooms(db *gorm.DB, userID uint) ([]RoomView, error) {
+	var rooms []models.Room
+	if err := db.Order("id").Find(&rooms).Error; err != nil {
+		return nil, fmt.Errorf("failed to list rooms: %w", err)
+	}
+
+	counts, err := puzzleCounts(db)
+	if err != nil {
+		return nil, err
+	}
+
+	visible, err := visibleTo(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var startedIDs []uint
+	if err := db.Model(&models.RoomSession{}).
+		Scopes(visible).
+		Distinct().
+		Pluck("room_id", &startedIDs).Error; err != nil {
+		return nil, fmt.Errorf("failed to get started rooms: %w", err)
+	}
+
+	views := make([]RoomView, 0, len(rooms))
+	for _, r := range rooms {
+		views = append(views, newRoomView(r, counts[r.ID], slices.Contains(startedIDs, r.ID)))
+	}
+	return views, nil
+}
+
+func GetRoom(db *gorm.DB, userID uint, roomID uint) (*RoomView, error) {
+	r, err := getRoom(db, roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Counted like ListRooms, so scheduled and unpublished puzzles stay hidden
+	var count int64
+	if err := db.Model(&models.Puzzle{}).
+		Where("room_id = ?", roomID).
+		Scopes(models.Published(time.Now())).
+		Count(&count).Error; err != nil {
+		return nil, fmt.Errorf("failed to count room puzzles: %w", err)
+	}
+
+	_, err = FindSession(db, userID, roomID)
+	if err != nil && !errors.Is(err, ErrRoomNotStarted) {
+		return nil, err
+	}
+
+	view := newRoomView(*r, count, err == nil)
+	return &view, nil
+}
+
+func getRoom(db *gorm.DB, roomID uint) (*models.Room, error) {
+	var r models.Room
+	if err := db.First(&r, roomID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRoomNotFound
+		}
+		return nil, fmt.Errorf("failed to get room: %w", err)
+	}
+	return &r, nil
+}
+
+func puzzleCounts(db *gorm.DB) (map[uint]int64, error) {
+	var rows []struct {
+		RoomID uint
+		Count  int64
+	}
+	if err := db.Model(&models.Puzzle{}).
+		Select("room_id, COUNT(*) AS count").
+		Where("room_id IS NOT NULL").
+		Scopes(models.Published(time.Now())).
+		Group("room_id").
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to count room puzzles: %w", err)
+	}
+
+	counts := make(map[uint]int64, len(rows))
+	for _, row := range rows {
+		counts[row.RoomID] = row.Count
+	}
+	return counts, nil
+}
+
+func newRoomView(r models.Room, puzzleCount int64, started bool) RoomView {
+	return RoomView{
+		ID:          r.ID,
+		Title:       r.Title,
+		Description: r.Description,
+		TimeLimit:   r.TimeLimit,
+		Difficulty:  r.Difficulty,
+		PuzzleCount: puzzleCount,
+		Started:     started,
+		CreatedAt:   r.CreatedAt,
+	}
+}
@@ -0,0 +1,452 @@
+package room
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/FieldPs/escape-room-backend/internal/events"
+	"github.com/FieldPs/escape-room-backend/internal/models"
+	"github.com/FieldPs/escape-room-backend/internal/team"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrRoomNotStarted  = errors.New("room not started")
+	ErrSessionNotFound = errors.New("session not found")
+	ErrSessionPaused   = errors.New("session is paused")
+	ErrSessionEnded    = errors.New("session has ended")
+	ErrSessionExpired  = errors.New("session time is up")
+)
+
+// SessionView is a session plus the clock as the server sees it
+type SessionView struct {
+	models.RoomSession
+	RemainingSeconds *int64    `json:"remaining_seconds"` // nil for untimed rooms
+	ServerTime       time.Time `json:"server_time"`
+}
+
+func NewSessionView(s models.RoomSession, now time.Time) SessionView {
+	view := SessionView{RoomSession: s, ServerTime: now}
+	if remaining, ok := Remaining(&s, now); ok {
+		seconds := int64(remaining.Seconds())
+		view.RemainingSeconds = &seconds
+	}
+	return view
+}
+
+// Remaining returns the time left on a session's clock. A paused clock is
+// frozen at the moment it was paused. ok is false for untimed rooms.
+func Remaining(s *models.RoomSession, now time.Time) (remaining time.Duration, ok bool) {
+	if s.Deadline == nil {
+		return 0, false
+	}
+	switch s.Status {
+	case models.SessionPaused:
+		now = *s.PausedAt
+	case models.SessionActive:
+	default:
+		return 0, true
+	}
+	return max(s.Deadline.Sub(now), 0), true
+}
+
+// Ended reports whether a session reached a final status
+func Ended(s *models.RoomSession) bool {
+	return s.Status != models.SessionActive && s.Status != models.SessionPaused
+}
+
+// StartRoom creates a session for the user, or for their whole team when
+// asTeam is set (captain only). Starting a room that is already in progress
+// returns the existing session; created reports whether a new one was made.
+// A room can only be played once solo and once per team.
+func StartRoom(db *gorm.DB, userID uint, roomID uint, asTeam bool) (session *models.RoomSession, created bool, err error) {
+	r, err := getRoom(db, roomID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var teamID *uint
+	if asTeam {
+		member, err := team.Membership(db, userID)
+		if err != nil {
+			return nil, false, err
+		}
+		if member.Role != models.TeamRoleCaptain {
+			return nil, false, team.ErrNotCaptain
+		}
+		teamID = &member.TeamID
+	}
+
+	// A running session the user can see (solo or team) is reused
+	session, err = FindSession(db, userID, roomID)
+	if err != nil && !errors.Is(err, ErrRoomNotStarted) {
+		return nil, false, err
+	}
+	if err == nil && !Ended(session) {
+		return session, false, nil
+	}
+
+	// Otherwise the room may only be started if this scope never played it
+	query := db.Model(&models.RoomSession{}).Where("room_id = ?", roomID)
+	if teamID != nil {
+		query = query.Where("team_id = ?", *teamID)
+	} else {
+		query = query.Where("user_id = ? AND team_id IS NULL", userID)
+	}
+	var played int64
+	if err := query.Count(&played).Error; err != nil {
+		return nil, false, fmt.Errorf("failed to check previous sessions: %w", err)
+	}
+	if played > 0 {
+		return nil, false, ErrSessionEnded
+	}
+
+	now := time.Now()
+	session = &models.RoomSession{
+		RoomID:    roomID,
+		UserID:    userID,
+		TeamID:    teamID,
+		Status:    models.SessionActive,
+		StartedAt: now,
+	}
+	if r.TimeLimit > 0 {
+		deadline := now.Add(time.Duration(r.TimeLimit) * time.Second)
+		session.Deadline = &deadline
+	}
+	if err := db.Create(session).Error; err != nil {
+		return nil, false, fmt.Errorf("failed to start room: %w", err)
+	}
+	publishSession(events.SessionStarted, userID, session, now)
+	return session, true, nil
+}
+
+// FindSession returns the session for a room the user plays in, solo or with
+// their team, or ErrRoomNotStarted. Running sessions win over finished ones.
+func FindSession(db *gorm.DB, userID uint, roomID uint) (*models.RoomSession, error) {
+	visible, err := visibleTo(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var session models.RoomSession
+	if err := db.Scopes(visible).
+		Where("room_id = ?", roomID).
+		Order(clause.Expr{
+			SQL:  "CASE WHEN status IN (?, ?) THEN 0 ELSE 1 END, started_at DESC",
+			Vars: []interface{}{models.SessionActive, models.SessionPaused},
+		}).
+		First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRoomNotStarted
+		}
+		return nil, fmt.Errorf("failed to get room session: %w", err)
+	}
+	return &session, nil
+}
+
+// ActiveSession returns the user's session for a room only if it is running.
+// A session found past its deadline is failed on the spot.
+func ActiveSession(db *gorm.DB, userID uint, roomID uint) (*models.RoomSession, error) {
+	session, err := FindSession(db, userID, roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch session.Status {
+	case models.SessionActive:
+	case models.SessionPaused:
+		return nil, ErrSessionPaused
+	case models.SessionFailed:
+		return nil, ErrSessionExpired
+	default:
+		return nil, ErrSessionEnded
+	}
+
+	if overdue(session, time.Now()) {
+		if err := expireSession(db, session); err != nil {
+			return nil, err
+		}
+		return nil, ErrSessionExpired
+	}
+	return session, nil
+}
+
+// GetSession returns one of the user's solo or team sessions
+func GetSession(db *gorm.DB, userID uint, sessionID uint) (*models.RoomSession, error) {
+	visible, err := visibleTo(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var session models.RoomSession
+	if err := db.Scopes(visible).Where("id = ?", sessionID).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+	return &session, nil
+}
+
+// PauseSession freezes the clock of an active session
+func PauseSession(db *gorm.DB, userID uint, sessionID uint) (*models.RoomSession, error) {
+	return updateSession(db, userID, sessionID, func(s *models.RoomSession, now time.Time) error {
+		if s.Status == models.SessionPaused {
+			return nil
+		}
+		if Ended(s) {
+			return ErrSessionEnded
+		}
+		if overdue(s, now) {
+			// Too late to pause: record the failure the sweeper would have
+			s.Status = models.SessionFailed
+			s.EndedAt = s.Deadline
+			return nil
+		}
+		s.Status = models.SessionPaused
+		s.PausedAt = &now
+		return nil
+	})
+}
+
+// ResumeSession restarts the clock, pushing the deadline back by the pause length
+func ResumeSession(db *gorm.DB, userID uint, sessionID uint) (*models.RoomSession, error) {
+	return updateSession(db, userID, sessionID, func(s *models.RoomSession, now time.Time) error {
+		if s.Status == models.SessionActive {
+			return nil
+		}
+		if s.Status != models.SessionPaused {
+			return ErrSessionEnded
+		}
+		paused := now.Sub(*s.PausedAt)
+		if s.Deadline != nil {
+			deadline := s.Deadline.Add(paused)
+			s.Deadline = &deadline
+		}
+		s.PausedSeconds += int64(paused.Seconds())
+		s.Status = models.SessionActive
+		s.PausedAt = nil
+		return nil
+	})
+}
+
+// AbandonSession gives up on a running or paused session. Only the captain
+// can abandon a team session.
+func AbandonSession(db *gorm.DB, userID uint, sessionID uint) (*models.RoomSession, error) {
+	return updateSession(db, userID, sessionID, func(s *models.RoomSession, now time.Time) error {
+		if Ended(s) {
+			return ErrSessionEnded
+		}
+		if s.TeamID != nil {
+			member, err := team.RequireMember(db, userID, *s.TeamID)
+			if err != nil {
+				return err
+			}
+			if member.Role != models.TeamRoleCaptain {
+				return team.ErrNotCaptain
+			}
+		}
+		if overdue(s, now) {
+			s.Status = models.SessionFailed
+			s.EndedAt = s.Deadline
+			return nil
+		}
+		s.Status = models.SessionAbandoned
+		s.EndedAt = &now
+		return nil
+	})
+}
+
+// EndSession sets a final status on a session, typically escaped once the
+// last puzzle is solved. It must run inside the solve transaction.
+func EndSession(tx *gorm.DB, s *models.RoomSession, status string) error {
+	now := time.Now()
+	s.Status = status
+	s.EndedAt = &now
+	if err := tx.Model(s).Updates(map[string]interface{}{
+		"status":   s.Status,
+		"ended_at": s.EndedAt,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to end session: %w", err)
+	}
+	return nil
+}
+
+// updateSession applies change to a locked session row and saves it
+func updateSession(db *gorm.DB, userID uint, sessionID uint, change func(*models.RoomSession, time.Time) error) (*models.RoomSession, error) {
+	visible, err := visibleTo(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var session models.RoomSession
+	var before string
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Scopes(visible).
+			Where("id = ?", sessionID).
+			First(&session).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrSessionNotFound
+			}
+			return fmt.Errorf("failed to get session: %w", err)
+		}
+
+		before = session.Status
+		if err := change(&session, time.Now()); err != nil {
+			return err
+		}
+		return tx.Select("status", "deadline", "paused_at", "ended_at", "paused_seconds").Save(&session).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if session.Status != before {
+		PublishSession(userID, &session)
+	}
+	return &session, nil
+}
+
+// PublishSession tells subscribers that a session was paused, resumed or
+// ended by the given user. Call it only after the change is committed.
+func PublishSession(userID uint, s *models.RoomSession) {
+	eventType := events.SessionEnded
+	switch s.Status {
+	case models.SessionActive:
+		eventType = events.SessionResumed
+	case models.SessionPaused:
+		eventType = events.SessionPaused
+	}
+	publishSession(eventType, userID, s, time.Now())
+}
+
+func publishSession(eventType string, userID uint, s *models.RoomSession, now time.Time) {
+	events.Publish(events.Event{
+		Type:      eventType,
+		UserID:    userID,
+		TeamID:    s.TeamID,
+		SessionID: &s.ID,
+		Data:      NewSessionView(*s, now),
+		At:        now,
+	})
+}
+
+// visibleTo limits a session query to the user's solo sessions and the
+// sessions of their current team
+func visibleTo(db *gorm.DB, userID uint) (func(*gorm.DB) *gorm.DB, error) {
+	teamID, err := team.TeamIDOf(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(q *gorm.DB) *gorm.DB {
+		if teamID == nil {
+			return q.Where("user_id = ? AND team_id IS NULL", userID)
+		}
+		return q.Where("((user_id = ? AND team_id IS NULL) OR team_id = ?)", userID, *teamID)
+	}, nil
+}
+
+// overdue reports whether an active session's deadline has passed
+func overdue(s *models.RoomSession, now time.Time) bool {
+	return s.Status == models.SessionActive && s.Deadline != nil && !now.Before(*s.Deadline)
+}
+
+func expireSession(db *gorm.DB, s *models.RoomSession) error {
+	result := db.Model(&models.RoomSession{}).
+		Where("id = ? AND status = ?", s.ID, models.SessionActive).
+		Updates(map[string]interface{}{
+			"status":   models.SessionFailed,
+			"ended_at": gorm.Expr("deadline"),
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to expire session: %w", result.Error)
+	}
+
+	// Only the request that actually expired it announces the end
+	if result.RowsAffected > 0 {
+		s.Status = models.SessionFailed
+		s.EndedAt = s.Deadline
+		PublishSession(s.UserID, s)
+	}
+	return nil
+}
+
+// ExpireOverdue fails every active session whose deadline has passed and
+// returns how many were expired
+func ExpireOverdue(db *gorm.DB) (int64, error) {
+	var expired []models.RoomSession
+	result := db.Model(&expired).
+		Clauses(clause.Returning{}).
+		Where("status = ? AND deadline <= ?", models.SessionActive, time.Now()).
+		Updates(map[string]interface{}{
+			"status":   models.SessionFailed,
+			"ended_at": gorm.Expr("deadline"),
+		})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to expire sessions: %w", result.Error)
+	}
+
+	for i := range expired {
+		PublishSession(expired[i].UserID, &expired[i])
+	}
+	return result.RowsAffected, nil
+}
+
+// RunSweeper expires overdue sessions every interval until ctx is done, so the
+// outcome is decided even if no player ever comes back
+func RunSweeper(ctx context.Context, db *gorm.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if n, err := ExpireOverdue(db); err != nil {
+				log.Println("Session sweeper:", err)
+			} else if n > 0 {
+				log.Printf("Session sweeper: expired %d session(s)", n)
+			}
+		}
+	}
+}
+
+// PublishTicks sends the current clock of every running timed session to its
+// subscribers
+func PublishTicks(db *gorm.DB) error {
+	var sessions []models.RoomSession
+	if err := db.Where("status = ? AND deadline IS NOT NULL", models.SessionActive).
+		Find(&sessions).Error; err != nil {
+		return fmt.Errorf("failed to list running sessions: %w", err)
+	}
+
+	now := time.Now()
+	for i := range sessions {
+		publishSession(events.SessionTick, sessions[i].UserID, &sessions[i], now)
+	}
+	return nil
+}
+
+// RunTicker publishes session clock ticks every interval until ctx is done
+func RunTicker(ctx context.Context, db *gorm.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := PublishTicks(db); err != nil {
+				log.Println("Session ticker:", err)
+			}
+		}
+	}
+}
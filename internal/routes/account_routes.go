@@ -0,0 +1,283 @@
+package routes
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/FieldPs/escape-room-backend/internal/account"
+	"github.com/FieldPs/escape-room-backend/internal/auth"
+	"github.com/FieldPs/escape-room-backend/internal/export"
+	"github.com/FieldPs/escape-room-backend/internal/mail"
+	"github.com/FieldPs/escape-room-backend/internal/models"
+	"github.com/FieldPs/escape-room-backend/internal/review"
+	"github.com/FieldPs/escape-room-backend/internal/streak"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RegisterAccountRoutes sets up endpoints for the caller's own account
+func RegisterAccountRoutes(r gin.IRouter, db *gorm.DB, mailer mail.Mailer) {
+	meGroup := r.Group("/me", AuthMiddleware(db))
+	{
+		meGroup.PUT("/time_zone", updateTimeZoneHandler(db))
+		meGroup.PUT("/review_mode", updateReviewModeHandler(db))
+		meGroup.GET("/email", getEmailHandler(db))
+		meGroup.PUT("/email", updateEmailHandler(db, mailer))
+		meGroup.POST("/email/resend", resendVerificationHandler(db, mailer))
+		meGroup.PUT("/password", changePasswordHandler(db))
+		meGroup.PUT("/username", changeUsernameHandler(db))
+		meGroup.DELETE("", deleteAccountHandler(db))
+		meGroup.GET("/export", exportHandler(db))
+		meGroup.GET("/exports/:id", exportJobHandler(db))
+	}
+
+	// Download links may be opened in a browser, so the JWT can come in the query
+	r.GET("/me/exports/:id/download", QueryAuthMiddleware(db), downloadExportHandler(db))
+}
+
+// updateTimeZoneHandler sets the IANA time zone streak days are counted in
+func updateTimeZoneHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("userID").(uint)
+
+		var input struct {
+			TimeZone string `json:"time_zone" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+			return
+		}
+
+		input.TimeZone = strings.TrimSpace(input.TimeZone)
+		if err := streak.ValidateTimeZone(input.TimeZone); err != nil {
+			respondError(c, err, "Invalid time zone")
+			return
+		}
+
+		if err := db.Model(&models.User{}).
+			Where("id = ?", userID).
+			Update("time_zone", input.TimeZone).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update time zone"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"time_zone": input.TimeZone})
+	}
+}
+
+// updateReviewModeHandler opts in to or out of spaced-repetition reviews
+func updateReviewModeHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("userID").(uint)
+
+		var input struct {
+			Enabled *bool `json:"enabled" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+			return
+		}
+
+		if err := review.SetMode(db, userID, *input.Enabled); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update review mode"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"review_mode": *input.Enabled})
+	}
+}
+
+// getEmailHandler returns the caller's email address and whether it is verified
+func getEmailHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("userID").(uint)
+
+		view, err := account.GetEmail(db, userID)
+		if err != nil {
+			respondError(c, err, "Failed to get email")
+			return
+		}
+		c.JSON(http.StatusOK, view)
+	}
+}
+
+// updateEmailHandler sets the caller's email address and sends a verification
+// link to it
+func updateEmailHandler(db *gorm.DB, mailer mail.Mailer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("userID").(uint)
+
+		var input struct {
+			Email string `json:"email" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+			return
+		}
+
+		view, err := account.SetEmail(db, mailer, userID, input.Email)
+		if err != nil {
+			respondError(c, err, "Failed to update email")
+			return
+		}
+		c.JSON(http.StatusOK, view)
+	}
+}
+
+// resendVerificationHandler sends a fresh verification link to the caller
+func resendVerificationHandler(db *gorm.DB, mailer mail.Mailer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("userID").(uint)
+
+		if err := account.ResendVerification(db, mailer, userID); err != nil {
+			respondError(c, err, "Failed to send verification email")
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{"message": "Verification email sent"})
+	}
+}
+
+// changePasswordHandler sets a new password after checking the current one.
+// Every other login is revoked and the caller gets a fresh token pair.
+func changePasswordHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims := c.MustGet("claims").(*auth.Claims)
+
+		var input struct {
+			OldPassword string `json:"old_password" binding:"required"`
+			NewPassword string `json:"new_password" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+			return
+		}
+
+		pair, err := account.ChangePassword(db, claims, input.OldPassword, input.NewPassword)
+		if err != nil {
+			respondError(c, err, "Failed to change password")
+			return
+		}
+		c.JSON(http.StatusOK, pair)
+	}
+}
+
+// changeUsernameHandler renames the caller's account
+func changeUsernameHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("userID").(uint)
+
+		var input struct {
+			Username string `json:"username" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+			return
+		}
+
+		username, err := account.ChangeUsername(db, userID, input.Username)
+		if err != nil {
+			respondError(c, err, "Failed to change username")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"username": username})
+	}
+}
+
+// deleteAccountHandler permanently deletes the caller's account and data
+// after checking the password
+func deleteAccountHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims := c.MustGet("claims").(*auth.Claims)
+
+		var input struct {
+			Password string `json:"password" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+			return
+		}
+
+		if err := account.DeleteAccount(db, claims, input.Password); err != nil {
+			respondError(c, err, "Failed to delete account")
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// exportHandler sends the caller's data as a zip of JSON files. Exports too
+// large to build during the request, or any with ?async=true, start a job
+// instead and answer 202 with links to poll and download it.
+func exportHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("userID").(uint)
+
+		rows, err := export.Rows(db, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export data"})
+			return
+		}
+
+		if c.Query("async") == "true" || rows > export.SyncMaxRows() {
+			job, err := export.Start(db, userID)
+			if err != nil {
+				respondError(c, err, "Failed to start export")
+				return
+			}
+			c.Header("Location", job.StatusURL)
+			c.JSON(http.StatusAccepted, job)
+			return
+		}
+
+		archive, err := export.Collect(db, userID)
+		if err != nil {
+			respondError(c, err, "Failed to export data")
+			return
+		}
+		c.Header("Content-Type", "application/zip")
+		c.Header("Content-Disposition", `attachment; filename="`+export.FileName(archive.Profile.Username, archive.GeneratedAt)+`"`)
+		c.Header("Cache-Control", "no-store")
+		c.Status(http.StatusOK)
+		// Headers are sent by now, so a failure can only cut the zip short
+		if err := archive.WriteZip(c.Writer); err != nil {
+			log.Printf("Export for user %d: %v", userID, err)
+		}
+	}
+}
+
+// exportJobHandler reports the status of one of the caller's export jobs
+func exportJobHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("userID").(uint)
+		jobID, ok := idParam(c, "id")
+		if !ok {
+			return
+		}
+
+		job, err := export.GetJob(db, userID, jobID)
+		if err != nil {
+			respondError(c, err, "Failed to get export")
+			return
+		}
+		c.JSON(http.StatusOK, job)
+	}
+}
+
+// downloadExportHandler sends a finished export job's zip
+func downloadExportHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("userID").(uint)
+		jobID, ok := idParam(c, "id")
+		if !ok {
+			return
+		}
+
+		path, name, err := export.Download(db, userID, jobID)
+		if err != nil {
+			respondError(c, err, "Failed to download export")
+			return
+		}
+		c.Header("Cache-Control", "no-store")
+		c.FileAttachment(path, name)
+	}
+}
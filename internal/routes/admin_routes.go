@@ -0,0 +1,334 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/FieldPs/escape-room-backend/internal/analytics"
+	"github.com/FieldPs/escape-room-backend/internal/models"
+	"github.com/FieldPs/escape-room-backend/internal/puzzle"
+	"github.com/FieldPs/escape-room-backend/internal/room"
+	"github.com/FieldPs/escape-room-backend/internal/scoring"
+	"github.com/FieldPs/escape-room-backend/internal/validation"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RegisterAdminRoutes sets up content management endpoints for admins
+func RegisterAdminRoutes(r gin.IRouter, db *gorm.DB) {
+	adminGroup := r.Group("/admin", AuthMiddleware(db), RequireRole(db, models.RoleAdmin))
+	{
+		adminGroup.POST("/puzzles", createPuzzleHandler(db))
+		adminGroup.PUT("/puzzles/:id", updatePuzzleHandler(db))
+		adminGroup.DELETE("/puzzles/:id", deletePuzzleHandler(db))
+		adminGroup.POST("/puzzles/:id/restore", restorePuzzleHandler(db))
+		adminGroup.GET("/puzzles/:id/prerequisites", getPrerequisitesHandler(db))
+		adminGroup.PUT("/puzzles/:id/prerequisites", setPrerequisitesHandler(db))
+
+		adminGroup.POST("/rooms", createRoomHandler(db))
+		adminGroup.PUT("/rooms/:id", updateRoomHandler(db))
+		adminGroup.DELETE("/rooms/:id", deleteRoomHandler(db))
+
+		adminGroup.GET("/daily", getDailyScheduleHandler(db))
+		adminGroup.PUT("/daily", scheduleDailyHandler(db))
+		adminGroup.DELETE("/daily/:date", unscheduleDailyHandler(db))
+
+		adminGroup.GET("/scoring", getScoringHandler(db))
+		adminGroup.PUT("/scoring", updateScoringHandler(db))
+
+		adminGroup.GET("/analytics/puzzles", listPuzzleAnalyticsHandler(db))
+		adminGroup.GET("/analytics/puzzles/:id", getPuzzleAnalyticsHandler(db))
+	}
+}
+
+func createPuzzleHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input puzzle.PuzzleInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+			return
+		}
+
+		p, err := puzzle.CreatePuzzle(db, input)
+		if err != nil {
+			respondAdminError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, p)
+	}
+}
+
+func updatePuzzleHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		puzzleID, ok := idParam(c, "id")
+		if !ok {
+			return
+		}
+
+		var input puzzle.PuzzleInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+			return
+		}
+
+		p, err := puzzle.UpdatePuzzle(db, puzzleID, input)
+		if err != nil {
+			respondAdminError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, p)
+	}
+}
+
+func deletePuzzleHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		puzzleID, ok := idParam(c, "id")
+		if !ok {
+			return
+		}
+
+		if err := puzzle.DeletePuzzle(db, puzzleID); err != nil {
+			respondAdminError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func restorePuzzleHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		puzzleID, ok := idParam(c, "id")
+		if !ok {
+			return
+		}
+
+		p, err := puzzle.RestorePuzzle(db, puzzleID)
+		if err != nil {
+			respondAdminError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, p)
+	}
+}
+
+func getPrerequisitesHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		puzzleID, ok := idParam(c, "id")
+		if !ok {
+			return
+		}
+
+		ids, err := puzzle.GetPrerequisites(db, puzzleID)
+		if err != nil {
+			respondAdminError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"puzzle_id": puzzleID, "prerequisite_ids": ids})
+	}
+}
+
+// setPrerequisitesHandler replaces the set of puzzles that unlock a puzzle
+func setPrerequisitesHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		puzzleID, ok := idParam(c, "id")
+		if !ok {
+			return
+		}
+
+		var input struct {
+			PrerequisiteIDs []uint `json:"prerequisite_ids" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+			return
+		}
+
+		if err := puzzle.SetPrerequisites(db, puzzleID, input.PrerequisiteIDs); err != nil {
+			respondAdminError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"puzzle_id": puzzleID, "prerequisite_ids": input.PrerequisiteIDs})
+	}
+}
+
+func createRoomHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input room.RoomInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+			return
+		}
+
+		r, err := room.CreateRoom(db, input)
+		if err != nil {
+			respondAdminError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, r)
+	}
+}
+
+func updateRoomHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roomID, ok := idParam(c, "id")
+		if !ok {
+			return
+		}
+
+		var input room.RoomInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+			return
+		}
+
+		r, err := room.UpdateRoom(db, roomID, input)
+		if err != nil {
+			respondAdminError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, r)
+	}
+}
+
+func deleteRoomHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roomID, ok := idParam(c, "id")
+		if !ok {
+			return
+		}
+
+		if err := room.DeleteRoom(db, roomID); err != nil {
+			respondAdminError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// listPuzzleAnalyticsHandler reports attempt analytics for every puzzle
+func listPuzzleAnalyticsHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		res, err := analytics.ListPuzzleAnalytics(db)
+		if err != nil {
+			respondAdminError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"puzzles": res})
+	}
+}
+
+// getPuzzleAnalyticsHandler reports analytics for one puzzle.
+// Query params: limit (number of common wrong answers, default 10)
+func getPuzzleAnalyticsHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		puzzleID, ok := idParam(c, "id")
+		if !ok {
+			return
+		}
+
+		var query struct {
+			Limit int `form:"limit,default=10" binding:"min=1,max=100"`
+		}
+		if err := c.ShouldBindQuery(&query); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query", "details": err.Error()})
+			return
+		}
+
+		res, err := analytics.GetPuzzleAnalytics(db, puzzleID, query.Limit)
+		if err != nil {
+			respondAdminError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+// getDailyScheduleHandler lists the daily puzzle schedule.
+// Query params: from, to (YYYY-MM-DD, inclusive; default today to a month ahead)
+func getDailyScheduleHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		entries, err := puzzle.GetSchedule(db, c.Query("from"), c.Query("to"))
+		if err != nil {
+			respondAdminError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"entries": entries})
+	}
+}
+
+// scheduleDailyHandler assigns puzzles to days, replacing existing entries on those days
+func scheduleDailyHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Entries []puzzle.ScheduleEntry `json:"entries" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+			return
+		}
+
+		entries, err := puzzle.ScheduleDaily(db, input.Entries)
+		if err != nil {
+			respondAdminError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"entries": entries})
+	}
+}
+
+func unscheduleDailyHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := puzzle.UnscheduleDaily(db, c.Param("date")); err != nil {
+			respondAdminError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func getScoringHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cfg, err := scoring.Get(db)
+		if err != nil {
+			respondAdminError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, cfg)
+	}
+}
+
+// updateScoringHandler replaces the scoring formula; solves already scored keep their points
+func updateScoringHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input models.ScoringConfig
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+			return
+		}
+
+		cfg, err := scoring.Update(db, input)
+		if err != nil {
+			respondAdminError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, cfg)
+	}
+}
+
+// respondAdminError maps errors from the content packages to HTTP responses
+func respondAdminError(c *gin.Context, err error) {
+	var validationErr *validation.Error
+	switch {
+	case errors.As(err, &validationErr):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "field": validationErr.Field, "details": validationErr.Message})
+	case errors.Is(err, puzzle.ErrPuzzleNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Puzzle not found"})
+	case errors.Is(err, room.ErrRoomNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+	case errors.Is(err, puzzle.ErrNoDailyPuzzle):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Nothing scheduled on that date"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
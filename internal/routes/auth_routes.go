@@ -2,24 +2,38 @@ package routes
 
 import (
 	"errors"
+	"log"
 	"net/http"
+	"slices"
 	"strings"
+	"time"
 
+	"github.com/FieldPs/escape-room-backend/internal/account"
 	"github.com/FieldPs/escape-room-backend/internal/auth"
+	"github.com/FieldPs/escape-room-backend/internal/mail"
 	"github.com/FieldPs/escape-room-backend/internal/models"
+	"github.com/FieldPs/escape-room-backend/internal/streak"
+	"github.com/FieldPs/escape-room-backend/internal/tokens"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
 // RegisterAuthRoutes sets up authentication-related endpoints
-func RegisterAuthRoutes(r gin.IRouter, db *gorm.DB) {
-	r.POST("/register", registerHandler(db))
+func RegisterAuthRoutes(r gin.IRouter, db *gorm.DB, mailer mail.Mailer) {
+	r.POST("/register", registerHandler(db, mailer))
 	r.POST("/login", loginHandler(db))
+	r.POST("/refresh", refreshHandler(db))
+	r.POST("/logout", AuthMiddleware(db), logoutHandler(db))
+	r.POST("/logout_all", AuthMiddleware(db), logoutAllHandler(db))
+
+	r.POST("/verify_email", verifyEmailHandler(db))
+	r.POST("/password_reset/request", requestPasswordResetHandler(db, mailer))
+	r.POST("/password_reset/confirm", confirmPasswordResetHandler(db))
 }
 
 // AuthMiddleware protects routes with JWT
-func AuthMiddleware() gin.HandlerFunc {
+func AuthMiddleware(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
@@ -27,10 +41,29 @@ func AuthMiddleware() gin.HandlerFunc {
 			c.Abort()
 			return
 		}
-		token := strings.TrimPrefix(authHeader, "Bearer ")
-		claims, err := auth.ValidateJWT(token)
+		authenticate(c, db, strings.TrimPrefix(authHeader, "Bearer "))
+	}
+}
+
+// QueryAuthMiddleware is AuthMiddleware for clients that cannot set headers,
+// such as browser WebSockets and EventSource. They pass a single-use ticket
+// from POST /stream_ticket as ?ticket= instead of the JWT, so no long-lived
+// token ends up in URLs or access logs. Only userID is set for ticket logins.
+func QueryAuthMiddleware(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ticket := c.Query("ticket")
+		if ticket == "" || c.GetHeader("Authorization") != "" {
+			AuthMiddleware(db)(c)
+			return
+		}
+
+		claims, err := tokens.ConsumeAction(db, ticket, streamTicketAction)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			if errors.Is(err, tokens.ErrInvalidActionToken) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired ticket"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			}
 			c.Abort()
 			return
 		}
@@ -39,12 +72,80 @@ func AuthMiddleware() gin.HandlerFunc {
 	}
 }
 
-// registerHandler handles user registration
-func registerHandler(db *gorm.DB) gin.HandlerFunc {
+// authenticate validates the token, rejects revoked ones by their jti and
+// sets userID and claims, aborting with a 401 otherwise
+func authenticate(c *gin.Context, db *gorm.DB, token string) {
+	claims, err := auth.ValidateJWT(token)
+	if err != nil || claims == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		c.Abort()
+		return
+	}
+
+	revoked, err := tokens.IsRevoked(db, claims.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		c.Abort()
+		return
+	}
+	if revoked {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Token revoked"})
+		c.Abort()
+		return
+	}
+
+	c.Set("userID", uint(claims.UserID))
+	c.Set("claims", claims)
+	c.Next()
+}
+
+// jwksHandler publishes the public verification keys as a JSON Web Key Set
+func jwksHandler(c *gin.Context) {
+	keys, err := auth.Keys()
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "No keys loaded"})
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, keys.JWKS())
+}
+
+// RequireRole must run after AuthMiddleware. It loads the caller's role from
+// the database so role changes take effect without reissuing tokens.
+func RequireRole(db *gorm.DB, roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("userID").(uint)
+
+		var user models.User
+		if err := db.Select("id", "role").First(&user, userID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			}
+			c.Abort()
+			return
+		}
+
+		if !slices.Contains(roles, user.Role) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
+			c.Abort()
+			return
+		}
+		c.Set("role", user.Role)
+		c.Next()
+	}
+}
+
+// registerHandler handles user registration. An optional email address is
+// sent a verification link once the account exists.
+func registerHandler(db *gorm.DB, mailer mail.Mailer) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var input struct {
 			Username string `json:"username" binding:"required"`
 			Password string `json:"password" binding:"required,min=6"`
+			TimeZone string `json:"time_zone"` // Optional IANA zone, defaults to UTC
+			Email    string `json:"email"`     // Optional, needed for password resets
 		}
 
 		if err := c.ShouldBindJSON(&input); err != nil {
@@ -52,6 +153,33 @@ func registerHandler(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		if input.TimeZone = strings.TrimSpace(input.TimeZone); input.TimeZone == "" {
+			input.TimeZone = streak.DefaultTimeZone
+		}
+		if err := streak.ValidateTimeZone(input.TimeZone); err != nil {
+			respondError(c, err, "Invalid time zone")
+			return
+		}
+
+		var email *string
+		if strings.TrimSpace(input.Email) != "" {
+			addr, err := account.ValidateEmail(input.Email)
+			if err != nil {
+				respondError(c, err, "Invalid email")
+				return
+			}
+			taken, err := account.EmailInUse(db, addr, 0)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Registration failed"})
+				return
+			}
+			if taken {
+				respondError(c, account.ErrEmailTaken, "Registration failed")
+				return
+			}
+			email = &addr
+		}
+
 		// Hash the password
 		hash, err := auth.HashPassword(input.Password)
 		if err != nil {
@@ -60,11 +188,15 @@ func registerHandler(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		// Use transaction to create both user and solved puzzle record
+		var user models.User
 		err = db.Transaction(func(tx *gorm.DB) error {
 			// Create user
-			user := models.User{
+			user = models.User{
 				Username:     input.Username,
 				PasswordHash: hash,
+				Role:         models.RolePlayer,
+				TimeZone:     input.TimeZone,
+				Email:        email,
 			}
 
 			if err := tx.Create(&user).Error; err != nil {
@@ -73,7 +205,7 @@ func registerHandler(db *gorm.DB) gin.HandlerFunc {
 
 			// Create initial UserSolvedPuzzle record
 			var totalPuzzles int64
-			if err := tx.Model(&models.Puzzle{}).Count(&totalPuzzles).Error; err != nil {
+			if err := tx.Model(&models.Puzzle{}).Scopes(models.Published(time.Now())).Count(&totalPuzzles).Error; err != nil {
 				return err
 			}
 
@@ -101,8 +233,19 @@ func registerHandler(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// The account exists either way; the link can be sent again later
+		verificationSent := false
+		if email != nil {
+			if err := account.SendVerification(db, mailer, user.ID, *email); err != nil {
+				log.Printf("Verification mail for user %d: %v", user.ID, err)
+			} else {
+				verificationSent = true
+			}
+		}
+
 		c.JSON(http.StatusCreated, gin.H{
-			"message": "User registered successfully",
+			"message":           "User registered successfully",
+			"verification_sent": verificationSent,
 		})
 	}
 }
@@ -145,8 +288,8 @@ func loginHandler(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Generate JWT token
-		token, err := auth.GenerateJWT(int(user.ID))
+		// Start a new login with an access and refresh token pair
+		pair, err := tokens.Issue(db, user.ID)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error":   "Failed to generate token",
@@ -157,7 +300,11 @@ func loginHandler(db *gorm.DB) gin.HandlerFunc {
 
 		// Successful login response
 		c.JSON(http.StatusOK, gin.H{
-			"token": token,
+			"token":              pair.AccessToken,
+			"token_type":         pair.TokenType,
+			"expires_in":         pair.ExpiresIn,
+			"refresh_token":      pair.RefreshToken,
+			"refresh_expires_at": pair.RefreshExpiresAt,
 			"user": gin.H{
 				"username": user.Username,
 				// Never include sensitive information here
@@ -165,3 +312,120 @@ func loginHandler(db *gorm.DB) gin.HandlerFunc {
 		})
 	}
 }
+
+// refreshHandler trades a refresh token for a new token pair. Each refresh
+// token works once; reusing one logs out every device in its login.
+func refreshHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			RefreshToken string `json:"refresh_token" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+			return
+		}
+
+		pair, err := tokens.Refresh(db, input.RefreshToken)
+		switch {
+		case errors.Is(err, tokens.ErrRefreshTokenReused):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token reused, please log in again"})
+		case errors.Is(err, tokens.ErrInvalidRefreshToken):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+		default:
+			c.JSON(http.StatusOK, pair)
+		}
+	}
+}
+
+// logoutHandler revokes the caller's access token and the login it belongs to
+func logoutHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims := c.MustGet("claims").(*auth.Claims)
+
+		if err := tokens.Logout(db, claims); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// logoutAllHandler revokes every login of the caller, on every device
+func logoutAllHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("userID").(uint)
+		claims := c.MustGet("claims").(*auth.Claims)
+
+		if err := tokens.LogoutAll(db, userID, claims); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// verifyEmailHandler marks an email address verified with the token from a
+// verification link
+func verifyEmailHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Token string `json:"token" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+			return
+		}
+
+		view, err := account.VerifyEmail(db, input.Token)
+		if err != nil {
+			respondError(c, err, "Failed to verify email")
+			return
+		}
+		c.JSON(http.StatusOK, view)
+	}
+}
+
+// requestPasswordResetHandler mails a reset link. It answers the same whether
+// or not the address belongs to an account.
+func requestPasswordResetHandler(db *gorm.DB, mailer mail.Mailer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Email string `json:"email" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+			return
+		}
+
+		if err := account.RequestPasswordReset(db, mailer, input.Email); err != nil {
+			respondError(c, err, "Failed to request password reset")
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{
+			"message": "If the address belongs to a verified account, a reset link is on its way",
+		})
+	}
+}
+
+// confirmPasswordResetHandler sets a new password with the token from a reset
+// link. Every existing login of the user is revoked.
+func confirmPasswordResetHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Token       string `json:"token" binding:"required"`
+			NewPassword string `json:"new_password" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+			return
+		}
+
+		if err := account.ResetPassword(db, input.Token, input.NewPassword); err != nil {
+			respondError(c, err, "Failed to reset password")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Password updated, please log in again"})
+	}
+}
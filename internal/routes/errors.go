@@ -0,0 +1,84 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/FieldPs/escape-room-backend/internal/account"
+	"github.com/FieldPs/escape-room-backend/internal/export"
+	"github.com/FieldPs/escape-room-backend/internal/puzzle"
+	"github.com/FieldPs/escape-room-backend/internal/review"
+	"github.com/FieldPs/escape-room-backend/internal/room"
+	"github.com/FieldPs/escape-room-backend/internal/team"
+	"github.com/FieldPs/escape-room-backend/internal/tokens"
+	"github.com/FieldPs/escape-room-backend/internal/validation"
+
+	"github.com/gin-gonic/gin"
+)
+
+// respondError maps errors from the domain packages to HTTP responses, falling
+// back to a 500 with the given message. It is shared by every route group
+// except admin, which has respondAdminError.
+func respondError(c *gin.Context, err error, fallback string) {
+	var validationErr *validation.Error
+	switch {
+	case errors.As(err, &validationErr):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "field": validationErr.Field, "details": validationErr.Message})
+	case errors.Is(err, puzzle.ErrPuzzleNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Puzzle not found"})
+	case errors.Is(err, puzzle.ErrNoDailyPuzzle):
+		c.JSON(http.StatusNotFound, gin.H{"error": "No daily puzzle today"})
+	case errors.Is(err, room.ErrRoomNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+	case errors.Is(err, room.ErrRoomNotStarted):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Room not started"})
+	case errors.Is(err, room.ErrSessionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+	case errors.Is(err, room.ErrSessionPaused):
+		c.JSON(http.StatusConflict, gin.H{"error": "Session is paused"})
+	case errors.Is(err, room.ErrSessionExpired):
+		c.JSON(http.StatusConflict, gin.H{"error": "Time is up"})
+	case errors.Is(err, room.ErrSessionEnded):
+		c.JSON(http.StatusConflict, gin.H{"error": "Session has ended"})
+	case errors.Is(err, puzzle.ErrPuzzleLocked):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Puzzle is locked", "details": err.Error()})
+	case errors.Is(err, puzzle.ErrNoMoreHints):
+		c.JSON(http.StatusConflict, gin.H{"error": "No more hints available"})
+	case errors.Is(err, review.ErrReviewModeOff):
+		c.JSON(http.StatusConflict, gin.H{"error": "Review mode is off"})
+	case errors.Is(err, review.ErrNotInReview):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Puzzle is not in your review queue"})
+	case errors.Is(err, review.ErrReviewNotDue):
+		c.JSON(http.StatusConflict, gin.H{"error": "Review is not due yet"})
+	case errors.Is(err, tokens.ErrInvalidActionToken):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired link"})
+	case errors.Is(err, export.ErrJobNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Export not found"})
+	case errors.Is(err, export.ErrJobNotReady), errors.Is(err, export.ErrJobFailed):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, export.ErrJobExpired):
+		c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+	case errors.Is(err, account.ErrUserNotFound), errors.Is(err, export.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	case errors.Is(err, account.ErrWrongPassword):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Password is incorrect"})
+	case errors.Is(err, account.ErrEmailTaken),
+		errors.Is(err, account.ErrUsernameTaken),
+		errors.Is(err, account.ErrNoEmail),
+		errors.Is(err, account.ErrAlreadyVerified):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, team.ErrTeamNotFound),
+		errors.Is(err, team.ErrNotInTeam),
+		errors.Is(err, team.ErrUserNotFound),
+		errors.Is(err, team.ErrInviteNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, team.ErrNotMember), errors.Is(err, team.ErrNotCaptain):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, team.ErrAlreadyInTeam),
+		errors.Is(err, team.ErrNameTaken),
+		errors.Is(err, team.ErrCaptainMustTransfer):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
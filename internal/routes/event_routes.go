@@ -0,0 +1,313 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FieldPs/escape-room-backend/internal/events"
+	"github.com/FieldPs/escape-room-backend/internal/leaderboard"
+	"github.com/FieldPs/escape-room-backend/internal/models"
+	"github.com/FieldPs/escape-room-backend/internal/room"
+	"github.com/FieldPs/escape-room-backend/internal/stats"
+	"github.com/FieldPs/escape-room-backend/internal/team"
+	"github.com/FieldPs/escape-room-backend/internal/tokens"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"gorm.io/gorm"
+)
+
+const (
+	wsWriteTimeout = 10 * time.Second
+	wsPingInterval = 30 * time.Second
+	wsPongTimeout  = 60 * time.Second
+
+	sseHeartbeatInterval = 15 * time.Second
+	sseFlushInterval     = time.Second // Bursts of solves are sent as one update
+	sseRetryMillis       = 3000
+
+	// Tickets stand in for the JWT on /ws and /stream and are used right away
+	streamTicketAction = "stream"
+	streamTicketTTL    = 30 * time.Second
+)
+
+var upgrader = websocket.Upgrader{CheckOrigin: checkOrigin}
+
+// checkOrigin accepts WebSockets from the origins in WS_ALLOWED_ORIGINS
+// (comma-separated, such as https://play.example.com), or from the API's own
+// host when it is unset. Clients that send no Origin are not browsers and
+// pass. The list is read on every call so values loaded from .env are picked up.
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	allowed := splitList(os.Getenv("WS_ALLOWED_ORIGINS"))
+	if len(allowed) == 0 {
+		u, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(u.Host, r.Host)
+	}
+	return slices.Contains(allowed, strings.TrimRight(origin, "/"))
+}
+
+// RegisterEventRoutes sets up the real-time event stream
+func RegisterEventRoutes(r gin.IRouter, db *gorm.DB) {
+	// Every stream shows the same board, so it is ranked once for all of them
+	live, err := leaderboard.NewLive(db, leaderboard.Query{}, sseFlushInterval, events.Default.LastID)
+	if err != nil {
+		panic(err) // The default board is always valid
+	}
+
+	r.POST("/stream_ticket", AuthMiddleware(db), streamTicketHandler(db))
+	r.GET("/ws", QueryAuthMiddleware(db), eventSocketHandler(db))
+	r.GET("/stream", QueryAuthMiddleware(db), statsStreamHandler(db, live))
+}
+
+// streamTicketHandler issues a short-lived single-use ticket for opening /ws
+// or /stream from a browser, which cannot send the Authorization header there
+func streamTicketHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("userID").(uint)
+
+		ticket, err := tokens.IssueTicket(db, userID, streamTicketAction, streamTicketTTL)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue ticket", "details": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"ticket": ticket, "expires_in": int(streamTicketTTL.Seconds())})
+	}
+}
+
+// eventSocketHandler upgrades to a WebSocket that pushes the caller's own
+// events, their team's, and those of ?session_id= when they can see it
+func eventSocketHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("userID").(uint)
+
+		filter, ok := eventFilter(c, db, userID)
+		if !ok {
+			return
+		}
+
+		conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			return // Upgrade already wrote the error response
+		}
+		defer conn.Close()
+
+		sub := events.Default.Subscribe(filter)
+		defer events.Default.Unsubscribe(sub)
+
+		// The read loop only answers control frames and notices the client leaving
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
+			conn.SetReadLimit(512)
+			conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+			conn.SetPongHandler(func(string) error {
+				return conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+			})
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}()
+
+		ping := time.NewTicker(wsPingInterval)
+		defer ping.Stop()
+
+		for {
+			select {
+			case <-closed:
+				return
+			case ev, ok := <-sub.C:
+				if !ok {
+					return
+				}
+				conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+				if err := conn.WriteJSON(ev); err != nil {
+					return
+				}
+			case <-ping.C:
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+// eventFilter builds the caller's subscription, writing an error response
+// when the requested session is not theirs
+func eventFilter(c *gin.Context, db *gorm.DB, userID uint) (events.Filter, bool) {
+	filter := events.Filter{UserID: userID}
+
+	teamID, err := team.TeamIDOf(db, userID)
+	if err != nil {
+		respondError(c, err, "Failed to subscribe")
+		return filter, false
+	}
+	filter.TeamID = teamID
+
+	if raw := c.Query("session_id"); raw != "" {
+		sessionID, err := strconv.ParseUint(raw, 10, 0)
+		if err != nil || sessionID == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session_id"})
+			return filter, false
+		}
+		session, err := room.GetSession(db, userID, uint(sessionID))
+		if err != nil {
+			respondError(c, err, "Failed to subscribe")
+			return filter, false
+		}
+		filter.SessionID = &session.ID
+	}
+	return filter, true
+}
+
+// statsStreamHandler is a Server-Sent Events fallback for networks that block
+// WebSockets. It sends the caller's stats and leaderboard position whenever a
+// solve changes them, plus their own and their team's solves. Every message
+// carries the ID of the last hub event it reflects, so a client reconnecting
+// with Last-Event-ID gets what it missed and a fresh snapshot only if needed.
+// The leaderboard comes from live, shared by every open stream.
+func statsStreamHandler(db *gorm.DB, live *leaderboard.Live) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("userID").(uint)
+
+		teamID, err := team.TeamIDOf(db, userID)
+		if err != nil {
+			respondError(c, err, "Failed to subscribe")
+			return
+		}
+		mine := events.Filter{UserID: userID, TeamID: teamID}
+
+		var user models.User
+		if err := db.Select("id", "username").First(&user, userID).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to subscribe", "details": err.Error()})
+			return
+		}
+
+		// Any solve can move the caller on the leaderboard; hints only change
+		// the stats of whoever unlocked them
+		all := events.Filter{Everyone: true, Types: []string{events.PuzzleSolved, events.HintUnlocked}}
+
+		var sub *events.Subscription
+		var missed []events.Event
+		complete := false
+		// Tickets are single-use, so a browser reconnects with a new ticket and
+		// passes the last ID itself instead of EventSource sending the header
+		resumeFrom := c.GetHeader("Last-Event-ID")
+		if resumeFrom == "" {
+			resumeFrom = c.Query("last_event_id")
+		}
+		if lastID, err := strconv.ParseUint(resumeFrom, 10, 64); err == nil {
+			sub, missed, complete = events.Default.SubscribeSince(all, lastID)
+		} else {
+			sub = events.Default.Subscribe(all)
+		}
+		defer events.Default.Unsubscribe(sub)
+		lastID := events.Default.LastID()
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		c.Header("X-Accel-Buffering", "no") // Stop proxies from buffering the stream
+		c.Status(http.StatusOK)
+		fmt.Fprintf(c.Writer, "retry: %d\n\n", sseRetryMillis)
+
+		statsDirty, positionDirty := !complete, !complete
+		for _, e := range missed {
+			lastID = e.ID
+			positionDirty = positionDirty || e.Type == events.PuzzleSolved
+			if mine.Matches(e) {
+				statsDirty = true
+				writeSSE(c, e.ID, e.Type, e)
+			}
+		}
+
+		// send writes the pending updates; it returns false once the client is gone
+		send := func() bool {
+			if statsDirty {
+				res, err := stats.GetUserStats(db, userID)
+				if err != nil {
+					log.Println("Stats stream:", err)
+				} else if !writeSSE(c, lastID, "stats", res) {
+					return false
+				}
+				statsDirty = false
+			}
+			if positionDirty {
+				// A board ranked before lastID is skipped; the next flush asks again
+				board, current, err := live.Board(userID, user.Username, lastID)
+				if err != nil {
+					log.Println("Stats stream:", err)
+				} else if current {
+					if !writeSSE(c, lastID, "leaderboard", board) {
+						return false
+					}
+					positionDirty = false
+				}
+			}
+			c.Writer.Flush()
+			return true
+		}
+		if !send() {
+			return
+		}
+
+		heartbeat := time.NewTicker(sseHeartbeatInterval)
+		defer heartbeat.Stop()
+		flush := time.NewTicker(sseFlushInterval)
+		defer flush.Stop()
+
+		for {
+			select {
+			case <-c.Request.Context().Done():
+				return
+			case e, ok := <-sub.C:
+				if !ok {
+					return
+				}
+				lastID = e.ID
+				positionDirty = positionDirty || e.Type == events.PuzzleSolved
+				if mine.Matches(e) {
+					statsDirty = true
+					if !writeSSE(c, e.ID, e.Type, e) {
+						return
+					}
+				}
+			case <-flush.C:
+				if !send() {
+					return
+				}
+			case <-heartbeat.C:
+				// A comment line keeps proxies from closing an idle stream
+				if _, err := fmt.Fprint(c.Writer, ": heartbeat\n\n"); err != nil {
+					return
+				}
+				c.Writer.Flush()
+			}
+		}
+	}
+}
+
+// writeSSE writes one Server-Sent Event; it returns false once the client is gone
+func writeSSE(c *gin.Context, id uint64, event string, data interface{}) bool {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Println("Stats stream:", err)
+		return true
+	}
+	_, err = fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", id, event, payload)
+	return err == nil
+}
@@ -0,0 +1,48 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/FieldPs/escape-room-backend/internal/leaderboard"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RegisterLeaderboardRoutes sets up ranking endpoints
+func RegisterLeaderboardRoutes(r gin.IRouter, db *gorm.DB) {
+	r.GET("/leaderboards", AuthMiddleware(db), leaderboardHandler(db))
+}
+
+// leaderboardHandler returns the top of a board and the caller's own rank.
+// Query params: kind (solves|streak|fastest), window (all|week|day), subject, room_id, limit
+func leaderboardHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("userID").(uint)
+
+		var query struct {
+			Kind    string `form:"kind"`
+			Window  string `form:"window"`
+			Subject string `form:"subject"`
+			RoomID  *uint  `form:"room_id"`
+			Limit   int    `form:"limit"`
+		}
+		if err := c.ShouldBindQuery(&query); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query", "details": err.Error()})
+			return
+		}
+
+		board, err := leaderboard.Get(db, userID, leaderboard.Query{
+			Kind:    query.Kind,
+			Window:  query.Window,
+			Subject: query.Subject,
+			RoomID:  query.RoomID,
+			Limit:   query.Limit,
+		})
+		if err != nil {
+			respondError(c, err, "Failed to fetch leaderboard")
+			return
+		}
+		c.JSON(http.StatusOK, board)
+	}
+}
@@ -2,8 +2,12 @@ package routes
 
 import (
 	"net/http"
+	"strconv"
+	"strings"
 
+	"github.com/FieldPs/escape-room-backend/internal/achievements"
 	"github.com/FieldPs/escape-room-backend/internal/puzzle"
+	"github.com/FieldPs/escape-room-backend/internal/recommend"
 	"github.com/FieldPs/escape-room-backend/internal/stats"
 
 	"github.com/gin-gonic/gin"
@@ -13,9 +17,15 @@ import (
 // RegisterPuzzleRoutes sets up puzzle and stats endpoints
 func RegisterPuzzleRoutes(r gin.IRouter, db *gorm.DB) {
 	// Protected routes under /api
-	authGroup := r.Group("/", AuthMiddleware())
+	authGroup := r.Group("/", AuthMiddleware(db))
 	{
 		authGroup.GET("/stats", statsHandler(db))
+		authGroup.GET("/achievements", achievementsHandler(db))
+		authGroup.GET("/puzzles", listPuzzlesHandler(db))
+		authGroup.GET("/puzzles/daily", dailyPuzzleHandler(db))
+		authGroup.GET("/puzzles/recommended", recommendedPuzzlesHandler(db))
+		authGroup.GET("/puzzles/:id", getPuzzleHandler(db))
+		authGroup.POST("/puzzles/:id/hints", unlockHintHandler(db))
 		authGroup.POST("/submit_answer", SubmitAnswerHandler(db))
 	}
 }
@@ -33,6 +43,134 @@ func statsHandler(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
+// achievementsHandler lists every badge with the caller's progress and unlock time
+func achievementsHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("userID").(uint)
+
+		badges, err := achievements.List(db, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch achievements"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"achievements": badges})
+	}
+}
+
+// listPuzzlesHandler returns a page of the puzzle catalog.
+// Query params: page, page_size, subject (comma separated), order (asc|desc), room_id
+func listPuzzlesHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("userID").(uint)
+
+		var query struct {
+			Page     int    `form:"page" binding:"omitempty,min=1"`
+			PageSize int    `form:"page_size" binding:"omitempty,min=1"`
+			Subject  string `form:"subject"`
+			Order    string `form:"order" binding:"omitempty,oneof=asc desc"`
+			RoomID   *uint  `form:"room_id"`
+		}
+		if err := c.ShouldBindQuery(&query); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid query",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		opts := puzzle.ListOptions{
+			Page:      query.Page,
+			PageSize:  query.PageSize,
+			Subjects:  splitList(query.Subject),
+			Ascending: query.Order == "asc",
+			RoomID:    query.RoomID,
+		}
+
+		res, err := puzzle.ListPuzzles(db, userID, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch puzzles"})
+			return
+		}
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+// getPuzzleHandler returns a single puzzle
+func getPuzzleHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("userID").(uint)
+
+		puzzleID, ok := idParam(c, "id")
+		if !ok {
+			return
+		}
+
+		view, err := puzzle.GetPuzzle(db, userID, puzzleID)
+		if err != nil {
+			respondError(c, err, "Failed to fetch puzzle")
+			return
+		}
+		c.JSON(http.StatusOK, view)
+	}
+}
+
+// dailyPuzzleHandler returns today's puzzle in the caller's time zone
+func dailyPuzzleHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("userID").(uint)
+
+		view, err := puzzle.GetDaily(db, userID)
+		if err != nil {
+			respondError(c, err, "Failed to fetch daily puzzle")
+			return
+		}
+		c.JSON(http.StatusOK, view)
+	}
+}
+
+// recommendedPuzzlesHandler suggests unsolved puzzles with the reason for each.
+// Query params: strategy (weakest_subject, skill_match, stale_subject), limit
+func recommendedPuzzlesHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("userID").(uint)
+
+		var query struct {
+			Strategy string `form:"strategy"`
+			Limit    int    `form:"limit"`
+		}
+		if err := c.ShouldBindQuery(&query); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query", "details": err.Error()})
+			return
+		}
+
+		res, err := recommend.Get(db, userID, recommend.Query{Strategy: query.Strategy, Limit: query.Limit})
+		if err != nil {
+			respondError(c, err, "Failed to fetch recommendations")
+			return
+		}
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+// unlockHintHandler reveals the caller's next hint for a puzzle
+func unlockHintHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("userID").(uint)
+
+		puzzleID, ok := idParam(c, "id")
+		if !ok {
+			return
+		}
+
+		res, err := puzzle.UnlockHint(db, userID, puzzleID)
+		if err != nil {
+			respondError(c, err, "Failed to unlock hint")
+			return
+		}
+		c.JSON(http.StatusOK, res)
+	}
+}
+
 func SubmitAnswerHandler(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID := c.MustGet("userID").(uint)
@@ -48,7 +186,7 @@ func SubmitAnswerHandler(db *gorm.DB) gin.HandlerFunc {
 
 		res, err := puzzle.CheckAnswer(db, userID, req)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, err, err.Error())
 			return
 		}
 
@@ -59,3 +197,24 @@ func SubmitAnswerHandler(db *gorm.DB) gin.HandlerFunc {
 		}
 	}
 }
+
+// idParam parses a numeric path parameter, writing a 400 response when invalid
+func idParam(c *gin.Context, name string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(name), 10, 0)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + name})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// splitList turns "a, b,c" into ["a" "b" "c"], dropping empty entries
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
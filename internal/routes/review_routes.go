@@ -0,0 +1,67 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/FieldPs/escape-room-backend/internal/puzzle"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RegisterReviewRoutes sets up the spaced-repetition review queue
+func RegisterReviewRoutes(r gin.IRouter, db *gorm.DB) {
+	reviewGroup := r.Group("/reviews", AuthMiddleware(db))
+	{
+		reviewGroup.GET("/due", dueReviewsHandler(db))
+		reviewGroup.POST("/:puzzle_id", submitReviewHandler(db))
+	}
+}
+
+// dueReviewsHandler lists solved puzzles due for review.
+// Query params: limit
+func dueReviewsHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("userID").(uint)
+
+		var query struct {
+			Limit int `form:"limit" binding:"omitempty,min=1"`
+		}
+		if err := c.ShouldBindQuery(&query); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query", "details": err.Error()})
+			return
+		}
+
+		res, err := puzzle.GetDueReviews(db, userID, query.Limit)
+		if err != nil {
+			respondError(c, err, "Failed to fetch reviews")
+			return
+		}
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+// submitReviewHandler answers a puzzle in review and reschedules it
+func submitReviewHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("userID").(uint)
+
+		puzzleID, ok := idParam(c, "puzzle_id")
+		if !ok {
+			return
+		}
+
+		var req puzzle.ReviewRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+			return
+		}
+
+		res, err := puzzle.SubmitReview(db, userID, puzzleID, req)
+		if err != nil {
+			respondError(c, err, "Failed to record review")
+			return
+		}
+		c.JSON(http.StatusOK, res)
+	}
+}
@@ -0,0 +1,155 @@
+package routes
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/FieldPs/escape-room-backend/internal/models"
+	"github.com/FieldPs/escape-room-backend/internal/puzzle"
+	"github.com/FieldPs/escape-room-backend/internal/room"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RegisterRoomRoutes sets up escape room endpoints
+func RegisterRoomRoutes(r gin.IRouter, db *gorm.DB) {
+	authGroup := r.Group("/rooms", AuthMiddleware(db))
+	{
+		authGroup.GET("", listRoomsHandler(db))
+		authGroup.GET("/:id", getRoomHandler(db))
+		authGroup.POST("/:id/start", startRoomHandler(db))
+		authGroup.GET("/:id/progress", roomProgressHandler(db))
+	}
+
+	sessionGroup := r.Group("/sessions", AuthMiddleware(db))
+	{
+		sessionGroup.GET("/:id", getSessionHandler(db))
+		sessionGroup.POST("/:id/pause", updateSessionHandler(db, room.PauseSession))
+		sessionGroup.POST("/:id/resume", updateSessionHandler(db, room.ResumeSession))
+		sessionGroup.POST("/:id/abandon", updateSessionHandler(db, room.AbandonSession))
+	}
+}
+
+func listRoomsHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("userID").(uint)
+
+		rooms, err := room.ListRooms(db, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch rooms"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"rooms": rooms})
+	}
+}
+
+func getRoomHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("userID").(uint)
+
+		roomID, ok := idParam(c, "id")
+		if !ok {
+			return
+		}
+
+		view, err := room.GetRoom(db, userID, roomID)
+		if err != nil {
+			respondError(c, err, "Failed to fetch room")
+			return
+		}
+		c.JSON(http.StatusOK, view)
+	}
+}
+
+// startRoomHandler starts a room and its clock for the caller, or for their
+// team with ?team=true. Starting again returns the running session; a
+// finished room cannot be replayed.
+func startRoomHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("userID").(uint)
+
+		roomID, ok := idParam(c, "id")
+		if !ok {
+			return
+		}
+
+		var query struct {
+			Team bool `form:"team"` // Start the room for the caller's whole team
+		}
+		if err := c.ShouldBindQuery(&query); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query", "details": err.Error()})
+			return
+		}
+
+		session, created, err := room.StartRoom(db, userID, roomID, query.Team)
+		if err != nil {
+			respondError(c, err, "Failed to start room")
+			return
+		}
+
+		view := room.NewSessionView(*session, time.Now())
+		if created {
+			c.JSON(http.StatusCreated, view)
+		} else {
+			c.JSON(http.StatusOK, view)
+		}
+	}
+}
+
+// roomProgressHandler lists the room's puzzles in order with the caller's progress
+func roomProgressHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("userID").(uint)
+
+		roomID, ok := idParam(c, "id")
+		if !ok {
+			return
+		}
+
+		progress, err := puzzle.GetRoomProgress(db, userID, roomID)
+		if err != nil {
+			respondError(c, err, "Failed to fetch progress")
+			return
+		}
+		c.JSON(http.StatusOK, progress)
+	}
+}
+
+// getSessionHandler returns a session with the server's view of its clock
+func getSessionHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("userID").(uint)
+
+		sessionID, ok := idParam(c, "id")
+		if !ok {
+			return
+		}
+
+		session, err := room.GetSession(db, userID, sessionID)
+		if err != nil {
+			respondError(c, err, "Failed to fetch session")
+			return
+		}
+		c.JSON(http.StatusOK, room.NewSessionView(*session, time.Now()))
+	}
+}
+
+// updateSessionHandler runs a pause, resume or abandon transition
+func updateSessionHandler(db *gorm.DB, update func(*gorm.DB, uint, uint) (*models.RoomSession, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("userID").(uint)
+
+		sessionID, ok := idParam(c, "id")
+		if !ok {
+			return
+		}
+
+		session, err := update(db, userID, sessionID)
+		if err != nil {
+			respondError(c, err, "Failed to update session")
+			return
+		}
+		c.JSON(http.StatusOK, room.NewSessionView(*session, time.Now()))
+	}
+}
@@ -1,19 +1,31 @@
 package routes
 
 import (
+	"github.com/FieldPs/escape-room-backend/internal/mail"
+
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
 // SetupRoutes configures all API endpoints
-func SetupRoutes(r *gin.Engine, db *gorm.DB) {
+func SetupRoutes(r *gin.Engine, db *gorm.DB, mailer mail.Mailer) {
 
 	apiV1 := r.Group("/api/v1")
 	{
-		RegisterAuthRoutes(apiV1, db)
+		RegisterAuthRoutes(apiV1, db, mailer)
+		RegisterAccountRoutes(apiV1, db, mailer)
 		RegisterPuzzleRoutes(apiV1, db)
+		RegisterReviewRoutes(apiV1, db)
+		RegisterRoomRoutes(apiV1, db)
+		RegisterTeamRoutes(apiV1, db)
+		RegisterEventRoutes(apiV1, db)
+		RegisterLeaderboardRoutes(apiV1, db)
+		RegisterAdminRoutes(apiV1, db)
 	}
 
+	// Public keys for services that verify our tokens
+	r.GET("/.well-known/jwks.json", jwksHandler)
+
 	r.GET("/healthz", func(c *gin.Context) {
 		sqlDB, err := db.DB()
 		if err != nil {
@@ -0,0 +1,202 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/FieldPs/escape-room-backend/internal/team"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RegisterTeamRoutes sets up team and invite endpoints
+func RegisterTeamRoutes(r gin.IRouter, db *gorm.DB) {
+	teamGroup := r.Group("/teams", AuthMiddleware(db))
+	{
+		teamGroup.POST("", createTeamHandler(db))
+		teamGroup.GET("/me", myTeamHandler(db))
+		teamGroup.POST("/me/leave", leaveTeamHandler(db))
+		teamGroup.POST("/:id/invites", inviteHandler(db))
+		teamGroup.POST("/:id/captain", transferCaptainHandler(db))
+		teamGroup.DELETE("/:id/members/:user_id", removeMemberHandler(db))
+	}
+
+	inviteGroup := r.Group("/invites", AuthMiddleware(db))
+	{
+		inviteGroup.GET("", listInvitesHandler(db))
+		inviteGroup.POST("/:id/accept", acceptInviteHandler(db))
+		inviteGroup.POST("/:id/decline", declineInviteHandler(db))
+	}
+}
+
+// createTeamHandler creates a team with the caller as captain
+func createTeamHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("userID").(uint)
+
+		var input struct {
+			Name string `json:"name" binding:"required,max=50"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+			return
+		}
+
+		view, err := team.CreateTeam(db, userID, input.Name)
+		if err != nil {
+			respondError(c, err, "Failed to create team")
+			return
+		}
+		c.JSON(http.StatusCreated, view)
+	}
+}
+
+func myTeamHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("userID").(uint)
+
+		view, err := team.GetMyTeam(db, userID)
+		if err != nil {
+			respondError(c, err, "Failed to fetch team")
+			return
+		}
+		c.JSON(http.StatusOK, view)
+	}
+}
+
+func leaveTeamHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("userID").(uint)
+
+		if err := team.Leave(db, userID); err != nil {
+			respondError(c, err, "Failed to leave team")
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// inviteHandler lets the captain invite a user by username
+func inviteHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("userID").(uint)
+
+		teamID, ok := idParam(c, "id")
+		if !ok {
+			return
+		}
+
+		var input struct {
+			Username string `json:"username" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+			return
+		}
+
+		invite, err := team.Invite(db, userID, teamID, input.Username)
+		if err != nil {
+			respondError(c, err, "Failed to invite user")
+			return
+		}
+		c.JSON(http.StatusCreated, invite)
+	}
+}
+
+// transferCaptainHandler hands the captaincy to another member
+func transferCaptainHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("userID").(uint)
+
+		teamID, ok := idParam(c, "id")
+		if !ok {
+			return
+		}
+
+		var input struct {
+			UserID uint `json:"user_id" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+			return
+		}
+
+		view, err := team.TransferCaptain(db, userID, teamID, input.UserID)
+		if err != nil {
+			respondError(c, err, "Failed to transfer captaincy")
+			return
+		}
+		c.JSON(http.StatusOK, view)
+	}
+}
+
+// removeMemberHandler lets the captain remove a member
+func removeMemberHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("userID").(uint)
+
+		teamID, ok := idParam(c, "id")
+		if !ok {
+			return
+		}
+		memberID, ok := idParam(c, "user_id")
+		if !ok {
+			return
+		}
+
+		if err := team.RemoveMember(db, userID, teamID, memberID); err != nil {
+			respondError(c, err, "Failed to remove member")
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// listInvitesHandler returns the caller's pending invites
+func listInvitesHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("userID").(uint)
+
+		invites, err := team.ListInvites(db, userID)
+		if err != nil {
+			respondError(c, err, "Failed to fetch invites")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"invites": invites})
+	}
+}
+
+func acceptInviteHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("userID").(uint)
+
+		inviteID, ok := idParam(c, "id")
+		if !ok {
+			return
+		}
+
+		view, err := team.AcceptInvite(db, userID, inviteID)
+		if err != nil {
+			respondError(c, err, "Failed to accept invite")
+			return
+		}
+		c.JSON(http.StatusOK, view)
+	}
+}
+
+func declineInviteHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("userID").(uint)
+
+		inviteID, ok := idParam(c, "id")
+		if !ok {
+			return
+		}
+
+		if err := team.DeclineInvite(db, userID, inviteID); err != nil {
+			respondError(c, err, "Failed to decline invite")
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
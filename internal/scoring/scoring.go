@@ -0,0 +1,169 @@
+package scoring
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/FieldPs/escape-room-backend/internal/models"
+	"github.com/FieldPs/escape-room-backend/internal/validation"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// configID is the primary key of the single scoring_configs row
+const configID = 1
+
+// DefaultConfig is used until an admin saves a formula
+func DefaultConfig() models.ScoringConfig {
+	return models.ScoringConfig{
+		ID:                   configID,
+		BasePoints:           100,
+		EasyMultiplier:       0.5,
+		MediumMultiplier:     1,
+		HardMultiplier:       2,
+		HintPenalty:          20,
+		AttemptPenalty:       5,
+		TimeGraceSeconds:     120,
+		TimePenaltyPerMinute: 1,
+		MaxTimePenalty:       30,
+		MinPoints:            10,
+	}
+}
+
+// Get returns the current formula, or the default when none was saved
+func Get(db *gorm.DB) (*models.ScoringConfig, error) {
+	var cfg models.ScoringConfig
+	err := db.First(&cfg, configID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		cfg = DefaultConfig()
+		return &cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get scoring config: %w", err)
+	}
+	return &cfg, nil
+}
+
+// Update validates and stores a new formula. It applies to solves from now
+// on; scores already earned are kept.
+func Update(db *gorm.DB, cfg models.ScoringConfig) (*models.ScoringConfig, error) {
+	if err := Validate(&cfg); err != nil {
+		return nil, err
+	}
+
+	cfg.ID = configID
+	if err := db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&cfg).Error; err != nil {
+		return nil, fmt.Errorf("failed to save scoring config: %w", err)
+	}
+	return &cfg, nil
+}
+
+func Validate(cfg *models.ScoringConfig) error {
+	if cfg.BasePoints < 1 {
+		return &validation.Error{Field: "base_points", Message: "must be at least 1"}
+	}
+	multipliers := map[string]float64{
+		"easy_multiplier":   cfg.EasyMultiplier,
+		"medium_multiplier": cfg.MediumMultiplier,
+		"hard_multiplier":   cfg.HardMultiplier,
+	}
+	for field, m := range multipliers {
+		if m <= 0 || math.IsNaN(m) || math.IsInf(m, 0) {
+			return &validation.Error{Field: field, Message: "must be a positive number"}
+		}
+	}
+	penalties := map[string]int{
+		"hint_penalty":            cfg.HintPenalty,
+		"attempt_penalty":         cfg.AttemptPenalty,
+		"time_grace_seconds":      cfg.TimeGraceSeconds,
+		"time_penalty_per_minute": cfg.TimePenaltyPerMinute,
+		"max_time_penalty":        cfg.MaxTimePenalty,
+		"min_points":              cfg.MinPoints,
+	}
+	for field, v := range penalties {
+		if v < 0 {
+			return &validation.Error{Field: field, Message: "must not be negative"}
+		}
+	}
+	return nil
+}
+
+// Solve describes a correct answer for scoring
+type Solve struct {
+	Difficulty    string
+	HintsUsed     int
+	WrongAttempts int64
+	LatencyMs     *int64 // Time since the puzzle was first opened; nil if it never was
+}
+
+// Breakdown shows how a score was reached
+type Breakdown struct {
+	BasePoints     int     `json:"base_points"`
+	Multiplier     float64 `json:"multiplier"`
+	HintPenalty    int     `json:"hint_penalty"`
+	AttemptPenalty int     `json:"attempt_penalty"`
+	TimePenalty    int     `json:"time_penalty"`
+	Total          int     `json:"total"`
+}
+
+// Compute applies the formula: base points scaled by difficulty, minus hint,
+// wrong attempt and time penalties, never below MinPoints. A solve with no
+// open time gets the full time penalty, so skipping the puzzle page saves nothing.
+func Compute(cfg *models.ScoringConfig, s Solve) Breakdown {
+	b := Breakdown{
+		BasePoints:     cfg.BasePoints,
+		Multiplier:     multiplier(cfg, s.Difficulty),
+		HintPenalty:    s.HintsUsed * cfg.HintPenalty,
+		AttemptPenalty: int(s.WrongAttempts) * cfg.AttemptPenalty,
+	}
+
+	if s.LatencyMs == nil {
+		b.TimePenalty = cfg.MaxTimePenalty
+	} else {
+		over := *s.LatencyMs/1000 - int64(cfg.TimeGraceSeconds)
+		if over > 0 {
+			b.TimePenalty = min(int(over/60)*cfg.TimePenaltyPerMinute, cfg.MaxTimePenalty)
+		}
+	}
+
+	scaled := int(math.Round(float64(cfg.BasePoints) * b.Multiplier))
+	b.Total = max(scaled-b.HintPenalty-b.AttemptPenalty-b.TimePenalty, min(cfg.MinPoints, scaled))
+	return b
+}
+
+func multiplier(cfg *models.ScoringConfig, difficulty string) float64 {
+	switch difficulty {
+	case models.DifficultyEasy:
+		return cfg.EasyMultiplier
+	case models.DifficultyHard:
+		return cfg.HardMultiplier
+	}
+	return cfg.MediumMultiplier
+}
+
+// UserTotal sums the points a user has earned, solo and in team sessions
+func UserTotal(db *gorm.DB, userID uint) (int64, error) {
+	return total(db, "user_id = ?", userID)
+}
+
+// TeamTotal sums the points the team's members earned in team sessions
+func TeamTotal(db *gorm.DB, teamID uint) (int64, error) {
+	return total(db, "team_id = ?", teamID)
+}
+
+// SessionTotal sums the points earned in one room session
+func SessionTotal(db *gorm.DB, sessionID uint) (int64, error) {
+	return total(db, "session_id = ?", sessionID)
+}
+
+func total(db *gorm.DB, query string, id uint) (int64, error) {
+	var sum int64
+	if err := db.Model(&models.UserPuzzle{}).
+		Select("COALESCE(SUM(score), 0)").
+		Where(query, id).
+		Scan(&sum).Error; err != nil {
+		return 0, fmt.Errorf("failed to sum scores: %w", err)
+	}
+	return sum, nil
+}
@@ -0,0 +1,109 @@
+package scoring
+
+import (
+	"testing"
+
+	"github.com/FieldPs/escape-room-backend/internal/models"
+)
+
+func TestCompute(t *testing.T) {
+	ms := func(v int64) *int64 { return &v }
+	cfg := DefaultConfig()
+	highFloor := DefaultConfig()
+	highFloor.MinPoints = 60
+	tiny := DefaultConfig()
+	tiny.BasePoints = 5
+
+	tests := []struct {
+		name  string
+		cfg   models.ScoringConfig
+		solve Solve
+		want  Breakdown
+	}{
+		{
+			name:  "medium",
+			cfg:   cfg,
+			solve: Solve{Difficulty: models.DifficultyMedium, LatencyMs: ms(0)},
+			want:  Breakdown{BasePoints: 100, Multiplier: 1, Total: 100},
+		},
+		{
+			name:  "easy",
+			cfg:   cfg,
+			solve: Solve{Difficulty: models.DifficultyEasy, LatencyMs: ms(0)},
+			want:  Breakdown{BasePoints: 100, Multiplier: 0.5, Total: 50},
+		},
+		{
+			name:  "hard",
+			cfg:   cfg,
+			solve: Solve{Difficulty: models.DifficultyHard, LatencyMs: ms(0)},
+			want:  Breakdown{BasePoints: 100, Multiplier: 2, Total: 200},
+		},
+		{
+			name:  "unknown difficulty scores as medium",
+			cfg:   cfg,
+			solve: Solve{Difficulty: "impossible", LatencyMs: ms(0)},
+			want:  Breakdown{BasePoints: 100, Multiplier: 1, Total: 100},
+		},
+		{
+			name:  "hint and attempt penalties",
+			cfg:   cfg,
+			solve: Solve{Difficulty: models.DifficultyMedium, HintsUsed: 2, WrongAttempts: 3, LatencyMs: ms(0)},
+			want:  Breakdown{BasePoints: 100, Multiplier: 1, HintPenalty: 40, AttemptPenalty: 15, Total: 45},
+		},
+		{
+			name:  "within the time grace",
+			cfg:   cfg,
+			solve: Solve{Difficulty: models.DifficultyMedium, LatencyMs: ms(120_000)},
+			want:  Breakdown{BasePoints: 100, Multiplier: 1, Total: 100},
+		},
+		{
+			name:  "part of a minute past the grace is free",
+			cfg:   cfg,
+			solve: Solve{Difficulty: models.DifficultyMedium, LatencyMs: ms(179_999)},
+			want:  Breakdown{BasePoints: 100, Multiplier: 1, Total: 100},
+		},
+		{
+			name:  "whole minutes past the grace",
+			cfg:   cfg,
+			solve: Solve{Difficulty: models.DifficultyMedium, LatencyMs: ms(300_000)},
+			want:  Breakdown{BasePoints: 100, Multiplier: 1, TimePenalty: 3, Total: 97},
+		},
+		{
+			name:  "time penalty is capped",
+			cfg:   cfg,
+			solve: Solve{Difficulty: models.DifficultyMedium, LatencyMs: ms(3_600_000)},
+			want:  Breakdown{BasePoints: 100, Multiplier: 1, TimePenalty: 30, Total: 70},
+		},
+		{
+			name:  "never opened takes the full time penalty",
+			cfg:   cfg,
+			solve: Solve{Difficulty: models.DifficultyMedium},
+			want:  Breakdown{BasePoints: 100, Multiplier: 1, TimePenalty: 30, Total: 70},
+		},
+		{
+			name:  "penalties stop at the floor",
+			cfg:   cfg,
+			solve: Solve{Difficulty: models.DifficultyMedium, HintsUsed: 10, LatencyMs: ms(0)},
+			want:  Breakdown{BasePoints: 100, Multiplier: 1, HintPenalty: 200, Total: 10},
+		},
+		{
+			name:  "floor never exceeds the scaled points",
+			cfg:   highFloor,
+			solve: Solve{Difficulty: models.DifficultyEasy, HintsUsed: 1, LatencyMs: ms(0)},
+			want:  Breakdown{BasePoints: 100, Multiplier: 0.5, HintPenalty: 20, Total: 50},
+		},
+		{
+			name:  "scaled points are rounded",
+			cfg:   tiny,
+			solve: Solve{Difficulty: models.DifficultyEasy, LatencyMs: ms(0)},
+			want:  Breakdown{BasePoints: 5, Multiplier: 0.5, Total: 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Compute(&tt.cfg, tt.solve); got != tt.want {
+				t.Errorf("Compute() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
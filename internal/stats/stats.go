@@ -1,11 +1,16 @@
 package stats
 
 import (
+	"errors"
 	"fmt"
 	"math"
 	"time"
 
+	"github.com/FieldPs/escape-room-backend/internal/achievements"
 	"github.com/FieldPs/escape-room-backend/internal/models"
+	"github.com/FieldPs/escape-room-backend/internal/rating"
+	"github.com/FieldPs/escape-room-backend/internal/scoring"
+	"github.com/FieldPs/escape-room-backend/internal/streak"
 	"gorm.io/gorm"
 )
 
@@ -19,25 +24,83 @@ type SubjectStat struct {
 type UserStatsResponse struct {
 	SubjectStats  map[string]SubjectStat `json:"subject_stats"`
 	CurrentStreak uint                   `json:"current_streak"`
+	StreakBroken  bool                   `json:"streak_broken"` // Yesterday and today were both missed
+	StreakFreezes uint                   `json:"streak_freezes"`
 	BestStreak    uint                   `json:"best_streak"`
+	TimeZone      string                 `json:"time_zone"`
 	LastSolvedAt  time.Time              `json:"last_solved_at"`
+	HintsUsed     int64                  `json:"hints_used"`
+	SolvedPuzzles uint                   `json:"solved_puzzles"` // Individual solves, solo or in a team
+	TotalScore    int64                  `json:"total_score"`    // Points from those solves
+	Rating        rating.View            `json:"skill"`          // Compare with puzzle ratings to find the right level
+	Team          *TeamStats             `json:"team,omitempty"`
+	Achievements  []achievements.Badge   `json:"achievements"` // Unlocked badges, most recent first
 }
 
 func GetUserStats(db *gorm.DB, userID uint) (*UserStatsResponse, error) {
 	// Initialize response with data from UserSolvedPuzzle
+	// Players who have not solved anything yet have no row and start at zero
 	var solvedPuzzle models.UserSolvedPuzzle
-	if err := db.Where("user_id = ?", userID).First(&solvedPuzzle).Error; err != nil {
+	err := db.Where("user_id = ?", userID).First(&solvedPuzzle).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, fmt.Errorf("failed to get user solved puzzles: %w", err)
 	}
 
+	// The stored streak only changes on a solve, so judge it against today
+	policy, err := streak.ForUser(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	current, broken := policy.Status(streak.FromStats(solvedPuzzle), time.Now())
+
 	response := &UserStatsResponse{
-		CurrentStreak: solvedPuzzle.CurrentStreak,
+		CurrentStreak: current,
+		StreakBroken:  broken,
+		StreakFreezes: solvedPuzzle.StreakFreezes,
 		BestStreak:    solvedPuzzle.BestStreak,
+		TimeZone:      policy.Location.String(),
 		LastSolvedAt:  solvedPuzzle.LastSolvedAt,
-		SubjectStats:  make(map[string]SubjectStat),
+		SolvedPuzzles: solvedPuzzle.SolvedPuzzles,
+	}
+
+	if response.TotalScore, err = scoring.UserTotal(db, userID); err != nil {
+		return nil, err
+	}
+
+	player, err := rating.ForUser(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	response.Rating = player.View()
+
+	// Team contributions, if the user is in a team
+	team, err := getTeamStats(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	response.Team = team
+
+	if response.Achievements, err = achievements.Unlocked(db, userID); err != nil {
+		return nil, err
 	}
 
-	// Get subject-level stats
+	// Count every hint the user has unlocked
+	if err := db.Model(&models.UserHint{}).
+		Where("user_id = ?", userID).
+		Count(&response.HintsUsed).Error; err != nil {
+		return nil, fmt.Errorf("failed to count hints: %w", err)
+	}
+
+	if response.SubjectStats, err = GetSubjectStats(db, userID); err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// GetSubjectStats reports, for every subject in the catalog, how many of its
+// published puzzles the user has solved
+func GetSubjectStats(db *gorm.DB, userID uint) (map[string]SubjectStat, error) {
 	var userPuzzles []models.UserPuzzle
 	if err := db.Preload("Puzzle").
 		Where("user_id = ?", userID).
@@ -49,30 +112,37 @@ func GetUserStats(db *gorm.DB, userID uint) (*UserStatsResponse, error) {
 	subjectTotals := make(map[string]int)
 	subjectSolved := make(map[string]int)
 
-	// First get all possible subjects and totals
+	// First get all possible subjects and totals; drafts, scheduled and
+	// retired puzzles are not part of the catalog
 	var puzzles []models.Puzzle
-	if err := db.Find(&puzzles).Error; err != nil {
+	if err := db.Scopes(models.Published(time.Now())).Find(&puzzles).Error; err != nil {
 		return nil, fmt.Errorf("failed to get puzzles: %w", err)
 	}
 
+	published := make(map[uint]bool, len(puzzles))
 	for _, p := range puzzles {
+		published[p.ID] = true
 		for _, subject := range p.Subjects {
 			subjectTotals[subject]++
 		}
 	}
 
-	// Then count solved per subject
+	// Then count solved per subject, among the same puzzles
 	for _, up := range userPuzzles {
+		if !published[up.PuzzleID] {
+			continue
+		}
 		for _, subject := range up.Puzzle.Subjects {
 			subjectSolved[subject]++
 		}
 	}
 
 	// Build subject stats
+	subjectStats := make(map[string]SubjectStat, len(subjectTotals))
 	for subject, total := range subjectTotals {
 		percentage := math.Round(float64(subjectSolved[subject])/float64(total)*100*100) / 100
 
-		response.SubjectStats[subject] = SubjectStat{
+		subjectStats[subject] = SubjectStat{
 			Subject:    subject,
 			Total:      total,
 			Solved:     subjectSolved[subject],
@@ -80,5 +150,5 @@ func GetUserStats(db *gorm.DB, userID uint) (*UserStatsResponse, error) {
 		}
 	}
 
-	return response, nil
+	return subjectStats, nil
 }
@@ -0,0 +1,85 @@
+package stats
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/FieldPs/escape-room-backend/internal/models"
+	"github.com/FieldPs/escape-room-backend/internal/scoring"
+	"github.com/FieldPs/escape-room-backend/internal/team"
+	"gorm.io/gorm"
+)
+
+type MemberContribution struct {
+	UserID   uint   `json:"user_id"`
+	Username string `json:"username"`
+	Solved   int64  `json:"solved"`
+	Score    int64  `json:"score"`
+}
+
+type TeamStats struct {
+	TeamID        uint                 `json:"team_id"`
+	Name          string               `json:"name"`
+	SolvedPuzzles int64                `json:"solved_puzzles"`   // Distinct puzzles solved in team sessions
+	Contributions int64                `json:"my_contributions"` // Of those, solved by the caller
+	Score         int64                `json:"score"`            // Points earned in team sessions
+	Members       []MemberContribution `json:"members"`
+}
+
+// getTeamStats returns the team side of a user's stats, or nil when they are not in a team
+func getTeamStats(db *gorm.DB, userID uint) (*TeamStats, error) {
+	view, err := team.GetMyTeam(db, userID)
+	if errors.Is(err, team.ErrNotInTeam) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res := &TeamStats{
+		TeamID:  view.ID,
+		Name:    view.Name,
+		Members: make([]MemberContribution, 0, len(view.Members)),
+	}
+
+	if err := db.Model(&models.UserPuzzle{}).
+		Where("team_id = ?", view.ID).
+		Distinct("puzzle_id").
+		Count(&res.SolvedPuzzles).Error; err != nil {
+		return nil, fmt.Errorf("failed to count team solves: %w", err)
+	}
+
+	if res.Score, err = scoring.TeamTotal(db, view.ID); err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		UserID uint
+		Solved int64
+		Score  int64
+	}
+	if err := db.Model(&models.UserPuzzle{}).
+		Select("user_id, COUNT(*) AS solved, COALESCE(SUM(score), 0) AS score").
+		Where("team_id = ?", view.ID).
+		Group("user_id").
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to count member solves: %w", err)
+	}
+	solvedBy := make(map[uint]int64, len(rows))
+	scoreBy := make(map[uint]int64, len(rows))
+	for _, row := range rows {
+		solvedBy[row.UserID] = row.Solved
+		scoreBy[row.UserID] = row.Score
+	}
+
+	for _, m := range view.Members {
+		res.Members = append(res.Members, MemberContribution{
+			UserID:   m.UserID,
+			Username: m.Username,
+			Solved:   solvedBy[m.UserID],
+			Score:    scoreBy[m.UserID],
+		})
+	}
+	res.Contributions = solvedBy[userID]
+	return res, nil
+}
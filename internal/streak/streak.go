@@ -0,0 +1,158 @@
+package streak
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/FieldPs/escape-room-backend/internal/models"
+	"github.com/FieldPs/escape-room-backend/internal/validation"
+	"gorm.io/gorm"
+)
+
+// DefaultTimeZone is used for users who never set one
+const DefaultTimeZone = "UTC"
+
+// Streak freezes are earned every FreezeEvery days of streak, up to MaxFreezes.
+// Each one covers a single missed day and is spent automatically.
+const (
+	FreezeEvery = 7
+	MaxFreezes  = 2
+)
+
+// State is the streak bookkeeping kept per user
+type State struct {
+	Current uint
+	Best    uint
+	Freezes uint
+	DayAt   time.Time // Last solve that counted toward the streak
+}
+
+// Policy decides where one day ends and the next begins for a user
+type Policy struct {
+	Location *time.Location
+	Grace    time.Duration // Solves this long after midnight still count for the day before
+}
+
+// ValidateTimeZone checks that name is an IANA time zone such as Asia/Bangkok
+func ValidateTimeZone(name string) error {
+	if name == "" || name == "Local" {
+		return &validation.Error{Field: "time_zone", Message: "must be an IANA time zone such as Asia/Bangkok"}
+	}
+	if _, err := time.LoadLocation(name); err != nil {
+		return &validation.Error{Field: "time_zone", Message: "unknown time zone " + strconv.Quote(name)}
+	}
+	return nil
+}
+
+// PolicyFor builds the policy for a user's time zone. An unknown zone falls
+// back to UTC. The grace period comes from STREAK_GRACE_HOURS (default 0).
+func PolicyFor(timeZone string) Policy {
+	loc, err := time.LoadLocation(timeZone)
+	if err != nil || timeZone == "" {
+		loc = time.UTC
+	}
+	return Policy{Location: loc, Grace: graceFromEnv()}
+}
+
+// ForUser loads the policy for a user's stored time zone
+func ForUser(db *gorm.DB, userID uint) (Policy, error) {
+	var user models.User
+	if err := db.Select("id", "time_zone").Where("id = ?", userID).Limit(1).Find(&user).Error; err != nil {
+		return Policy{}, fmt.Errorf("failed to get time zone: %w", err)
+	}
+	return PolicyFor(user.TimeZone), nil
+}
+
+// FromStats reads the streak state out of a user's stats row
+func FromStats(s models.UserSolvedPuzzle) State {
+	return State{
+		Current: s.CurrentStreak,
+		Best:    s.BestStreak,
+		Freezes: s.StreakFreezes,
+		DayAt:   s.StreakDayAt,
+	}
+}
+
+// DailyOnly reports whether only daily puzzle solves count toward streaks,
+// set with STREAK_DAILY_ONLY=true
+func DailyOnly() bool {
+	only, _ := strconv.ParseBool(os.Getenv("STREAK_DAILY_ONLY"))
+	return only
+}
+
+// graceFromEnv is read on every call so values loaded from .env are picked up
+func graceFromEnv() time.Duration {
+	raw := os.Getenv("STREAK_GRACE_HOURS")
+	if raw == "" {
+		return 0
+	}
+	hours, err := strconv.Atoi(raw)
+	if err != nil || hours < 0 || hours > 12 {
+		log.Printf("Ignoring STREAK_GRACE_HOURS=%q: must be a whole number of hours from 0 to 12", raw)
+		return 0
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// Date is the calendar day t falls on in the policy's zone, as midnight UTC
+func (p Policy) Date(t time.Time) time.Time {
+	y, m, d := t.Add(-p.Grace).In(p.Location).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// Day numbers the calendar day t falls on in the policy's zone, so
+// consecutive days differ by exactly one regardless of DST
+func (p Policy) Day(t time.Time) int64 {
+	return p.Date(t).Unix() / (24 * 60 * 60)
+}
+
+// missedDays is how many whole days passed without a counted solve between
+// the last one and the day of t
+func (p Policy) missedDays(s State, t time.Time) int64 {
+	return p.Day(t) - p.Day(s.DayAt) - 1
+}
+
+// Record returns the state after a solve at the given time. Missed days are
+// covered by freezes when there are enough of them; otherwise the streak
+// starts over.
+func (p Policy) Record(s State, at time.Time) State {
+	switch missed := p.missedDays(s, at); {
+	case s.DayAt.IsZero() || s.Current == 0:
+		s.Current = 1
+	case missed < 0:
+		// Another solve on the same day
+	case missed == 0:
+		s.Current++
+	case missed <= int64(s.Freezes):
+		s.Freezes -= uint(missed)
+		s.Current++
+	default:
+		s.Current = 1
+	}
+
+	if s.Current > s.Best {
+		s.Best = s.Current
+	}
+	// A new day that lands on a multiple of FreezeEvery earns a freeze
+	if s.Current%FreezeEvery == 0 && p.Day(at) != p.Day(s.DayAt) && s.Freezes < MaxFreezes {
+		s.Freezes++
+	}
+	s.DayAt = at
+	return s
+}
+
+// Status reports the streak as of now. Once yesterday and today both went
+// without a solve, the next solve can only start over, so the streak shows
+// as broken unless freezes cover the missed days.
+func (p Policy) Status(s State, now time.Time) (current uint, broken bool) {
+	if s.DayAt.IsZero() || s.Current == 0 {
+		return 0, false
+	}
+	if p.missedDays(s, now) > int64(s.Freezes) {
+		return 0, true
+	}
+	return s.Current, false
+}
@@ -0,0 +1,186 @@
+package streak
+
+import (
+	"testing"
+	"time"
+)
+
+func mustLoad(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("LoadLocation(%q): %v", name, err)
+	}
+	return loc
+}
+
+func TestRecord(t *testing.T) {
+	utc := Policy{Location: time.UTC}
+	bangkok := Policy{Location: mustLoad(t, "Asia/Bangkok")}
+	newYork := Policy{Location: mustLoad(t, "America/New_York")}
+	graceful := Policy{Location: time.UTC, Grace: 2 * time.Hour}
+
+	day := func(p Policy, y int, m time.Month, d, h, min int) time.Time {
+		return time.Date(y, m, d, h, min, 0, 0, p.Location)
+	}
+
+	tests := []struct {
+		name   string
+		policy Policy
+		state  State
+		at     time.Time
+		want   State
+	}{
+		{
+			name:   "first solve",
+			policy: utc,
+			at:     day(utc, 2026, 5, 1, 12, 0),
+			want:   State{Current: 1, Best: 1},
+		},
+		{
+			name:   "same day",
+			policy: utc,
+			state:  State{Current: 3, Best: 5, DayAt: day(utc, 2026, 5, 1, 8, 0)},
+			at:     day(utc, 2026, 5, 1, 23, 59),
+			want:   State{Current: 3, Best: 5},
+		},
+		{
+			name:   "next day",
+			policy: utc,
+			state:  State{Current: 3, Best: 3, DayAt: day(utc, 2026, 5, 1, 23, 59)},
+			at:     day(utc, 2026, 5, 2, 0, 0),
+			want:   State{Current: 4, Best: 4},
+		},
+		{
+			name:   "missed day starts over",
+			policy: utc,
+			state:  State{Current: 4, Best: 4, DayAt: day(utc, 2026, 5, 1, 12, 0)},
+			at:     day(utc, 2026, 5, 3, 12, 0),
+			want:   State{Current: 1, Best: 4},
+		},
+		{
+			name:   "freeze covers a missed day",
+			policy: utc,
+			state:  State{Current: 8, Best: 8, Freezes: 1, DayAt: day(utc, 2026, 5, 1, 12, 0)},
+			at:     day(utc, 2026, 5, 3, 12, 0),
+			want:   State{Current: 9, Best: 9},
+		},
+		{
+			name:   "freezes cover two missed days",
+			policy: utc,
+			state:  State{Current: 8, Best: 8, Freezes: 2, DayAt: day(utc, 2026, 5, 1, 12, 0)},
+			at:     day(utc, 2026, 5, 4, 12, 0),
+			want:   State{Current: 9, Best: 9},
+		},
+		{
+			name:   "too few freezes keeps them and starts over",
+			policy: utc,
+			state:  State{Current: 8, Best: 10, Freezes: 1, DayAt: day(utc, 2026, 5, 1, 12, 0)},
+			at:     day(utc, 2026, 5, 4, 12, 0),
+			want:   State{Current: 1, Best: 10, Freezes: 1},
+		},
+		{
+			name:   "seventh day earns a freeze",
+			policy: utc,
+			state:  State{Current: 6, Best: 6, DayAt: day(utc, 2026, 5, 1, 12, 0)},
+			at:     day(utc, 2026, 5, 2, 12, 0),
+			want:   State{Current: 7, Best: 7, Freezes: 1},
+		},
+		{
+			name:   "same-day solve on a seventh day earns nothing more",
+			policy: utc,
+			state:  State{Current: 7, Best: 7, Freezes: 1, DayAt: day(utc, 2026, 5, 2, 8, 0)},
+			at:     day(utc, 2026, 5, 2, 12, 0),
+			want:   State{Current: 7, Best: 7, Freezes: 1},
+		},
+		{
+			name:   "freezes are capped",
+			policy: utc,
+			state:  State{Current: 13, Best: 13, Freezes: MaxFreezes, DayAt: day(utc, 2026, 5, 1, 12, 0)},
+			at:     day(utc, 2026, 5, 2, 12, 0),
+			want:   State{Current: 14, Best: 14, Freezes: MaxFreezes},
+		},
+		{
+			name:   "local midnight, same UTC day",
+			policy: bangkok,
+			state:  State{Current: 1, Best: 1, DayAt: day(bangkok, 2026, 5, 1, 23, 0)},
+			at:     day(bangkok, 2026, 5, 2, 1, 0),
+			want:   State{Current: 2, Best: 2},
+		},
+		{
+			name:   "local same day across UTC midnight",
+			policy: newYork,
+			state:  State{Current: 1, Best: 1, DayAt: day(newYork, 2026, 5, 1, 10, 0)},
+			at:     day(newYork, 2026, 5, 1, 23, 0),
+			want:   State{Current: 1, Best: 1},
+		},
+		{
+			name:   "spring forward day is 23 hours",
+			policy: newYork,
+			state:  State{Current: 1, Best: 1, DayAt: day(newYork, 2026, 3, 7, 23, 30)},
+			at:     day(newYork, 2026, 3, 8, 23, 30),
+			want:   State{Current: 2, Best: 2},
+		},
+		{
+			name:   "fall back day is 25 hours",
+			policy: newYork,
+			state:  State{Current: 1, Best: 1, DayAt: day(newYork, 2026, 10, 31, 0, 30)},
+			at:     day(newYork, 2026, 11, 1, 23, 30),
+			want:   State{Current: 2, Best: 2},
+		},
+		{
+			name:   "grace counts an early solve for the day before",
+			policy: graceful,
+			state:  State{Current: 2, Best: 2, DayAt: day(utc, 2026, 5, 1, 12, 0)},
+			at:     day(utc, 2026, 5, 3, 1, 30),
+			want:   State{Current: 3, Best: 3},
+		},
+		{
+			name:   "solve after the grace window is a new day",
+			policy: graceful,
+			state:  State{Current: 2, Best: 2, DayAt: day(utc, 2026, 5, 1, 12, 0)},
+			at:     day(utc, 2026, 5, 3, 2, 0),
+			want:   State{Current: 1, Best: 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.want.DayAt = tt.at
+			if got := tt.policy.Record(tt.state, tt.at); got != tt.want {
+				t.Errorf("Record() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatus(t *testing.T) {
+	utc := Policy{Location: time.UTC}
+	newYork := Policy{Location: mustLoad(t, "America/New_York")}
+	last := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		policy      Policy
+		state       State
+		now         time.Time
+		wantCurrent uint
+		wantBroken  bool
+	}{
+		{"never solved", utc, State{}, last, 0, false},
+		{"solved today", utc, State{Current: 3, DayAt: last}, last.Add(time.Hour), 3, false},
+		{"solved yesterday", utc, State{Current: 3, DayAt: last}, last.Add(35 * time.Hour), 3, false},
+		{"missed yesterday", utc, State{Current: 3, DayAt: last}, last.Add(37 * time.Hour), 0, true},
+		{"missed yesterday with a freeze", utc, State{Current: 3, Freezes: 1, DayAt: last}, last.Add(37 * time.Hour), 3, false},
+		{"missed two days with one freeze", utc, State{Current: 3, Freezes: 1, DayAt: last}, last.Add(61 * time.Hour), 0, true},
+		// 12:00 UTC is 08:00 in New York; 02:00 UTC two days later is still the next local day
+		{"next local day", newYork, State{Current: 3, DayAt: last}, last.Add(38 * time.Hour), 3, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current, broken := tt.policy.Status(tt.state, tt.now)
+			if current != tt.wantCurrent || broken != tt.wantBroken {
+				t.Errorf("Status() = %d, %v, want %d, %v", current, broken, tt.wantCurrent, tt.wantBroken)
+			}
+		})
+	}
+}
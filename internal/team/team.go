@@ -0,0 +1,421 @@
+package team
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/FieldPs/escape-room-backend/internal/models"
+	"github.com/FieldPs/escape-room-backend/internal/validation"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrTeamNotFound        = errors.New("team not found")
+	ErrNotInTeam           = errors.New("not in a team")
+	ErrNotMember           = errors.New("not a member of this team")
+	ErrNotCaptain          = errors.New("only the captain can do this")
+	ErrAlreadyInTeam       = errors.New("already in a team")
+	ErrNameTaken           = errors.New("team name already taken")
+	ErrUserNotFound        = errors.New("user not found")
+	ErrInviteNotFound      = errors.New("invite not found")
+	ErrCaptainMustTransfer = errors.New("captain must transfer the captaincy before leaving")
+)
+
+type MemberView struct {
+	UserID   uint      `json:"user_id"`
+	Username string    `json:"username"`
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+type TeamView struct {
+	ID        uint         `json:"id"`
+	Name      string       `json:"name"`
+	CreatedAt time.Time    `json:"created_at"`
+	Members   []MemberView `json:"members"`
+}
+
+type InviteView struct {
+	ID        uint      `json:"id"`
+	TeamID    uint      `json:"team_id"`
+	TeamName  string    `json:"team_name"`
+	InvitedBy uint      `json:"invited_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Membership returns the user's team membership, or ErrNotInTeam
+func Membership(db *gorm.DB, userID uint) (*models.TeamMember, error) {
+	var member models.TeamMember
+	if err := db.Where("user_id = ?", userID).First(&member).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotInTeam
+		}
+		return nil, fmt.Errorf("failed to get team membership: %w", err)
+	}
+	return &member, nil
+}
+
+// TeamIDOf returns the user's team ID, or nil when they are not in a team
+func TeamIDOf(db *gorm.DB, userID uint) (*uint, error) {
+	member, err := Membership(db, userID)
+	if errors.Is(err, ErrNotInTeam) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &member.TeamID, nil
+}
+
+// CreateTeam creates a team with the user as its captain
+func CreateTeam(db *gorm.DB, userID uint, name string) (*TeamView, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, &validation.Error{Field: "name", Message: "must not be empty"}
+	}
+
+	var t models.Team
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if _, err := Membership(tx, userID); err == nil {
+			return ErrAlreadyInTeam
+		} else if !errors.Is(err, ErrNotInTeam) {
+			return err
+		}
+
+		var count int64
+		if err := tx.Model(&models.Team{}).Where("name = ?", name).Count(&count).Error; err != nil {
+			return fmt.Errorf("failed to check team name: %w", err)
+		}
+		if count > 0 {
+			return ErrNameTaken
+		}
+
+		t = models.Team{Name: name}
+		if err := tx.Create(&t).Error; err != nil {
+			return fmt.Errorf("failed to create team: %w", err)
+		}
+		return addMember(tx, t.ID, userID, models.TeamRoleCaptain)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetTeam(db, t.ID)
+}
+
+// GetMyTeam returns the caller's team with its members
+func GetMyTeam(db *gorm.DB, userID uint) (*TeamView, error) {
+	member, err := Membership(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	return GetTeam(db, member.TeamID)
+}
+
+func GetTeam(db *gorm.DB, teamID uint) (*TeamView, error) {
+	var t models.Team
+	if err := db.First(&t, teamID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTeamNotFound
+		}
+		return nil, fmt.Errorf("failed to get team: %w", err)
+	}
+
+	var members []models.TeamMember
+	if err := db.Preload("User").
+		Where("team_id = ?", teamID).
+		Order("joined_at").
+		Find(&members).Error; err != nil {
+		return nil, fmt.Errorf("failed to get team members: %w", err)
+	}
+
+	view := &TeamView{
+		ID:        t.ID,
+		Name:      t.Name,
+		CreatedAt: t.CreatedAt,
+		Members:   make([]MemberView, 0, len(members)),
+	}
+	for _, m := range members {
+		view.Members = append(view.Members, MemberView{
+			UserID:   m.UserID,
+			Username: m.User.Username,
+			Role:     m.Role,
+			JoinedAt: m.JoinedAt,
+		})
+	}
+	return view, nil
+}
+
+// Invite lets a captain invite a user by username
+func Invite(db *gorm.DB, captainID uint, teamID uint, username string) (*models.TeamInvite, error) {
+	if err := requireCaptain(db, captainID, teamID); err != nil {
+		return nil, err
+	}
+
+	var invitee models.User
+	if err := db.Where("username = ?", strings.TrimSpace(username)).First(&invitee).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if _, err := Membership(db, invitee.ID); err == nil {
+		return nil, ErrAlreadyInTeam
+	} else if !errors.Is(err, ErrNotInTeam) {
+		return nil, err
+	}
+
+	// Re-inviting returns the pending invite instead of stacking duplicates
+	invite := models.TeamInvite{
+		TeamID:    teamID,
+		UserID:    invitee.ID,
+		InvitedBy: captainID,
+		Status:    models.InvitePending,
+	}
+	if err := db.Where(models.TeamInvite{TeamID: teamID, UserID: invitee.ID, Status: models.InvitePending}).
+		FirstOrCreate(&invite).Error; err != nil {
+		return nil, fmt.Errorf("failed to create invite: %w", err)
+	}
+	return &invite, nil
+}
+
+// ListInvites returns the user's pending invites
+func ListInvites(db *gorm.DB, userID uint) ([]InviteView, error) {
+	var invites []models.TeamInvite
+	if err := db.Preload("Team").
+		Where("user_id = ? AND status = ?", userID, models.InvitePending).
+		Order("created_at DESC").
+		Find(&invites).Error; err != nil {
+		return nil, fmt.Errorf("failed to get invites: %w", err)
+	}
+
+	views := make([]InviteView, 0, len(invites))
+	for _, inv := range invites {
+		views = append(views, InviteView{
+			ID:        inv.ID,
+			TeamID:    inv.TeamID,
+			TeamName:  inv.Team.Name,
+			InvitedBy: inv.InvitedBy,
+			CreatedAt: inv.CreatedAt,
+		})
+	}
+	return views, nil
+}
+
+// AcceptInvite joins the inviting team
+func AcceptInvite(db *gorm.DB, userID uint, inviteID uint) (*TeamView, error) {
+	var teamID uint
+	err := db.Transaction(func(tx *gorm.DB) error {
+		invite, err := pendingInvite(tx, userID, inviteID)
+		if err != nil {
+			return err
+		}
+
+		if _, err := Membership(tx, userID); err == nil {
+			return ErrAlreadyInTeam
+		} else if !errors.Is(err, ErrNotInTeam) {
+			return err
+		}
+
+		if err := respond(tx, invite, models.InviteAccepted); err != nil {
+			return err
+		}
+		teamID = invite.TeamID
+		return addMember(tx, invite.TeamID, userID, models.TeamRoleMember)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetTeam(db, teamID)
+}
+
+func DeclineInvite(db *gorm.DB, userID uint, inviteID uint) error {
+	invite, err := pendingInvite(db, userID, inviteID)
+	if err != nil {
+		return err
+	}
+	return respond(db, invite, models.InviteDeclined)
+}
+
+// Leave removes the user from their team. The last member leaving disbands it.
+func Leave(db *gorm.DB, userID uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		member, err := Membership(tx, userID)
+		if err != nil {
+			return err
+		}
+
+		var count int64
+		if err := tx.Model(&models.TeamMember{}).Where("team_id = ?", member.TeamID).Count(&count).Error; err != nil {
+			return fmt.Errorf("failed to count members: %w", err)
+		}
+		if member.Role == models.TeamRoleCaptain && count > 1 {
+			return ErrCaptainMustTransfer
+		}
+
+		if err := tx.Delete(member).Error; err != nil {
+			return fmt.Errorf("failed to leave team: %w", err)
+		}
+		if count == 1 {
+			return disband(tx, member.TeamID)
+		}
+		return nil
+	})
+}
+
+// RemoveMember lets the captain remove another member
+func RemoveMember(db *gorm.DB, captainID uint, teamID uint, memberID uint) error {
+	if err := requireCaptain(db, captainID, teamID); err != nil {
+		return err
+	}
+	if memberID == captainID {
+		return ErrCaptainMustTransfer
+	}
+
+	result := db.Where("team_id = ? AND user_id = ?", teamID, memberID).Delete(&models.TeamMember{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to remove member: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotMember
+	}
+	return nil
+}
+
+// TransferCaptain hands the captaincy to another member
+func TransferCaptain(db *gorm.DB, captainID uint, teamID uint, memberID uint) (*TeamView, error) {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := requireCaptain(tx, captainID, teamID); err != nil {
+			return err
+		}
+
+		result := tx.Model(&models.TeamMember{}).
+			Where("team_id = ? AND user_id = ?", teamID, memberID).
+			Update("role", models.TeamRoleCaptain)
+		if result.Error != nil {
+			return fmt.Errorf("failed to transfer captaincy: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotMember
+		}
+
+		if memberID == captainID {
+			return nil
+		}
+		return tx.Model(&models.TeamMember{}).
+			Where("team_id = ? AND user_id = ?", teamID, captainID).
+			Update("role", models.TeamRoleMember).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetTeam(db, teamID)
+}
+
+// RequireMember checks that the user belongs to the team
+func RequireMember(db *gorm.DB, userID uint, teamID uint) (*models.TeamMember, error) {
+	member, err := Membership(db, userID)
+	if errors.Is(err, ErrNotInTeam) {
+		return nil, ErrNotMember
+	}
+	if err != nil {
+		return nil, err
+	}
+	if member.TeamID != teamID {
+		return nil, ErrNotMember
+	}
+	return member, nil
+}
+
+func requireCaptain(db *gorm.DB, userID uint, teamID uint) error {
+	member, err := RequireMember(db, userID, teamID)
+	if err != nil {
+		return err
+	}
+	if member.Role != models.TeamRoleCaptain {
+		return ErrNotCaptain
+	}
+	return nil
+}
+
+func addMember(tx *gorm.DB, teamID uint, userID uint, role string) error {
+	if err := tx.Create(&models.TeamMember{
+		TeamID:   teamID,
+		UserID:   userID,
+		Role:     role,
+		JoinedAt: time.Now(),
+	}).Error; err != nil {
+		return fmt.Errorf("failed to add team member: %w", err)
+	}
+	return nil
+}
+
+func pendingInvite(db *gorm.DB, userID uint, inviteID uint) (*models.TeamInvite, error) {
+	var invite models.TeamInvite
+	if err := db.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND user_id = ? AND status = ?", inviteID, userID, models.InvitePending).
+		First(&invite).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInviteNotFound
+		}
+		return nil, fmt.Errorf("failed to get invite: %w", err)
+	}
+	return &invite, nil
+}
+
+func respond(db *gorm.DB, invite *models.TeamInvite, status string) error {
+	now := time.Now()
+	if err := db.Model(invite).Updates(models.TeamInvite{Status: status, RespondedAt: &now}).Error; err != nil {
+		return fmt.Errorf("failed to update invite: %w", err)
+	}
+	return nil
+}
+
+// disband deletes an empty team and its invites. Solves and sessions recorded
+// for the team keep their team_id so history is preserved.
+func disband(tx *gorm.DB, teamID uint) error {
+	if err := tx.Where("team_id = ?", teamID).Delete(&models.TeamInvite{}).Error; err != nil {
+		return fmt.Errorf("failed to delete invites: %w", err)
+	}
+	if err := tx.Delete(&models.Team{}, teamID).Error; err != nil {
+		return fmt.Errorf("failed to delete team: %w", err)
+	}
+	return nil
+}
+
+// RemoveUser takes a deleted account out of its team inside tx. A captain
+// hands the captaincy to the longest-serving member; the last member leaving
+// disbands the team.
+func RemoveUser(tx *gorm.DB, userID uint) error {
+	member, err := Membership(tx, userID)
+	if errors.Is(err, ErrNotInTeam) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Delete(member).Error; err != nil {
+		return fmt.Errorf("failed to leave team: %w", err)
+	}
+
+	var next models.TeamMember
+	if err := tx.Where("team_id = ?", member.TeamID).
+		Order("joined_at ASC, id ASC").
+		Limit(1).
+		Find(&next).Error; err != nil {
+		return fmt.Errorf("failed to get team members: %w", err)
+	}
+	if next.ID == 0 {
+		return disband(tx, member.TeamID)
+	}
+	if member.Role == models.TeamRoleCaptain {
+		if err := tx.Model(&next).Update("role", models.TeamRoleCaptain).Error; err != nil {
+			return fmt.Errorf("failed to transfer captaincy: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,310 @@
+package tokens
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/FieldPs/escape-room-backend/internal/auth"
+	"github.com/FieldPs/escape-room-backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token was already used")
+	ErrInvalidActionToken  = errors.New("invalid, expired or used token")
+)
+
+// Pair is what a client gets on login and on every refresh
+type Pair struct {
+	AccessToken      string    `json:"token"`
+	TokenType        string    `json:"token_type"`
+	ExpiresIn        int       `json:"expires_in"` // Seconds until the access token expires
+	RefreshToken     string    `json:"refresh_token"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+// Issue starts a new token family for a fresh login
+func Issue(db *gorm.DB, userID uint) (*Pair, error) {
+	family, err := auth.NewTokenID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token family: %w", err)
+	}
+	return issue(db, userID, family, time.Now())
+}
+
+func issue(db *gorm.DB, userID uint, family string, now time.Time) (*Pair, error) {
+	access, claims, err := auth.GenerateJWT(int(userID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate access token: %w", err)
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	refresh := base64.RawURLEncoding.EncodeToString(raw)
+
+	row := models.RefreshToken{
+		UserID:          userID,
+		FamilyID:        family,
+		TokenHash:       hash(refresh),
+		AccessJTI:       claims.ID,
+		AccessExpiresAt: claims.ExpiresAt.Time,
+		ExpiresAt:       now.Add(auth.RefreshTTL()),
+	}
+	if err := db.Create(&row).Error; err != nil {
+		return nil, fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	return &Pair{
+		AccessToken:      access,
+		TokenType:        "Bearer",
+		ExpiresIn:        int(claims.ExpiresAt.Sub(claims.IssuedAt.Time).Seconds()),
+		RefreshToken:     refresh,
+		RefreshExpiresAt: row.ExpiresAt,
+	}, nil
+}
+
+// Refresh rotates a refresh token: the presented one is spent and a new pair
+// in the same family is returned. A token presented a second time means it
+// leaked, so the whole family is revoked and the caller must log in again.
+func Refresh(db *gorm.DB, refreshToken string) (*Pair, error) {
+	now := time.Now()
+	var pair *Pair
+	reused := false
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var row models.RefreshToken
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", hash(refreshToken)).
+			First(&row).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidRefreshToken
+			}
+			return fmt.Errorf("failed to get refresh token: %w", err)
+		}
+
+		if row.UsedAt != nil || row.RevokedAt != nil {
+			reused = row.UsedAt != nil
+			if reused {
+				return revoke(tx, "family_id", row.FamilyID, now)
+			}
+			return ErrInvalidRefreshToken
+		}
+		if !row.ExpiresAt.After(now) {
+			return ErrInvalidRefreshToken
+		}
+
+		if err := tx.Model(&row).Update("used_at", now).Error; err != nil {
+			return fmt.Errorf("failed to spend refresh token: %w", err)
+		}
+		var err error
+		pair, err = issue(tx, row.UserID, row.FamilyID, now)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	// The revocation above must commit, so reuse is reported only afterwards
+	if reused {
+		return nil, ErrRefreshTokenReused
+	}
+	return pair, nil
+}
+
+// Logout ends the login the access token belongs to: its refresh token family
+// and every access token issued in it
+func Logout(db *gorm.DB, claims *auth.Claims) error {
+	now := time.Now()
+	return db.Transaction(func(tx *gorm.DB) error {
+		var row models.RefreshToken
+		err := tx.Where("access_jti = ?", claims.ID).Limit(1).Find(&row).Error
+		if err != nil {
+			return fmt.Errorf("failed to find login: %w", err)
+		}
+		if row.ID != 0 {
+			if err := revoke(tx, "family_id", row.FamilyID, now); err != nil {
+				return err
+			}
+		}
+		// Also covers tokens whose refresh rows were purged
+		return deny(tx, claims.ID, uint(claims.UserID), claims.ExpiresAt.Time, now)
+	})
+}
+
+// LogoutAll ends every login of the user
+func LogoutAll(db *gorm.DB, userID uint, claims *auth.Claims) error {
+	now := time.Now()
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := revoke(tx, "user_id", userID, now); err != nil {
+			return err
+		}
+		return deny(tx, claims.ID, userID, claims.ExpiresAt.Time, now)
+	})
+}
+
+// RevokeUser ends every login of the user, such as after a password change.
+// Call it inside the transaction that makes the change.
+func RevokeUser(tx *gorm.DB, userID uint) error {
+	return revoke(tx, "user_id", userID, time.Now())
+}
+
+// revoke revokes the refresh tokens whose column equals value, a family or a
+// user, and denies the access tokens issued with them that have not expired yet
+func revoke(tx *gorm.DB, column string, value interface{}, now time.Time) error {
+	var rows []models.RefreshToken
+	if err := tx.Where(column+" = ?", value).Find(&rows).Error; err != nil {
+		return fmt.Errorf("failed to get refresh tokens: %w", err)
+	}
+
+	if err := tx.Model(&models.RefreshToken{}).
+		Where(column+" = ? AND revoked_at IS NULL", value).
+		Update("revoked_at", now).Error; err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+
+	for _, row := range rows {
+		if row.AccessJTI == "" || !row.AccessExpiresAt.After(now) {
+			continue
+		}
+		if err := deny(tx, row.AccessJTI, row.UserID, row.AccessExpiresAt, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func deny(tx *gorm.DB, jti string, userID uint, expiresAt time.Time, now time.Time) error {
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.RevokedToken{
+		JTI:       jti,
+		UserID:    userID,
+		ExpiresAt: expiresAt,
+		RevokedAt: now,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to revoke access token: %w", err)
+	}
+	return nil
+}
+
+// IsRevoked reports whether an access token was revoked before it expired
+func IsRevoked(db *gorm.DB, jti string) (bool, error) {
+	var count int64
+	if err := db.Model(&models.RevokedToken{}).Where("jti = ?", jti).Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to check token revocation: %w", err)
+	}
+	return count > 0, nil
+}
+
+// Purge deletes refresh, action and revoked tokens that have expired; expired
+// tokens are rejected anyway
+func Purge(db *gorm.DB, now time.Time) (int64, error) {
+	refresh := db.Where("expires_at <= ?", now).Delete(&models.RefreshToken{})
+	if refresh.Error != nil {
+		return 0, fmt.Errorf("failed to purge refresh tokens: %w", refresh.Error)
+	}
+	revoked := db.Where("expires_at <= ?", now).Delete(&models.RevokedToken{})
+	if revoked.Error != nil {
+		return 0, fmt.Errorf("failed to purge revoked tokens: %w", revoked.Error)
+	}
+	actions := db.Where("expires_at <= ?", now).Delete(&models.ActionToken{})
+	if actions.Error != nil {
+		return 0, fmt.Errorf("failed to purge action tokens: %w", actions.Error)
+	}
+	return refresh.RowsAffected + revoked.RowsAffected + actions.RowsAffected, nil
+}
+
+// RunPurger purges expired tokens every interval until ctx is done
+func RunPurger(ctx context.Context, db *gorm.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if n, err := Purge(db, time.Now()); err != nil {
+				log.Println("Token purger:", err)
+			} else if n > 0 {
+				log.Printf("Token purger: removed %d expired token(s)", n)
+			}
+		}
+	}
+}
+
+// IssueAction signs a single-use token for an account action. Earlier unused
+// tokens of the user for the same action stop working.
+func IssueAction(db *gorm.DB, userID uint, action string, email string, ttl time.Duration) (string, error) {
+	return issueAction(db, userID, action, email, ttl, true)
+}
+
+// IssueTicket signs a single-use token like IssueAction, but earlier tickets
+// stay valid, so several tabs or devices can each hold one
+func IssueTicket(db *gorm.DB, userID uint, action string, ttl time.Duration) (string, error) {
+	return issueAction(db, userID, action, "", ttl, false)
+}
+
+func issueAction(db *gorm.DB, userID uint, action string, email string, ttl time.Duration, replace bool) (string, error) {
+	token, claims, err := auth.SignAction(action, int(userID), email, ttl)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign %s token: %w", action, err)
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if replace {
+			if err := tx.Model(&models.ActionToken{}).
+				Where("user_id = ? AND action = ? AND used_at IS NULL", userID, action).
+				Update("used_at", time.Now()).Error; err != nil {
+				return fmt.Errorf("failed to replace %s tokens: %w", action, err)
+			}
+		}
+		if err := tx.Create(&models.ActionToken{
+			JTI:       claims.ID,
+			UserID:    userID,
+			Action:    action,
+			ExpiresAt: claims.ExpiresAt.Time,
+		}).Error; err != nil {
+			return fmt.Errorf("failed to store %s token: %w", action, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ConsumeAction checks an action token and marks it used. Call it inside the
+// transaction that performs the action so a failure leaves the token usable.
+func ConsumeAction(tx *gorm.DB, token string, action string) (*auth.ActionClaims, error) {
+	claims, err := auth.ValidateAction(token, action)
+	if err != nil {
+		return nil, ErrInvalidActionToken
+	}
+
+	result := tx.Model(&models.ActionToken{}).
+		Where("jti = ? AND action = ? AND used_at IS NULL", claims.ID, action).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to use %s token: %w", action, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrInvalidActionToken
+	}
+	return claims, nil
+}
+
+// hash is how refresh tokens are stored; they are random, so a fast hash is enough
+func hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
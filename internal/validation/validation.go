@@ -0,0 +1,11 @@
+package validation
+
+// Error reports an invalid field in client input
+type Error struct {
+	Field   string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Field + ": " + e.Message
+}
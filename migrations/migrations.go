@@ -1,34 +1,123 @@
 package migrations
 
 import (
+	"fmt"
 	"math/rand"
+	"os"
 	"time"
 
 	"gorm.io/gorm"
 
+	"github.com/FieldPs/escape-room-backend/internal/achievements"
 	"github.com/FieldPs/escape-room-backend/internal/auth"
 	"github.com/FieldPs/escape-room-backend/internal/models"
+	"github.com/FieldPs/escape-room-backend/internal/puzzle"
 	"github.com/lib/pq"
 )
 
 func MigrateAll(db *gorm.DB) error {
 	// 1. Auto-migrate all models FIRST
 	err := db.AutoMigrate(
+		&models.Room{},
 		&models.Puzzle{},
+		&models.Team{},
+		&models.TeamMember{},
+		&models.TeamInvite{},
 		&models.User{},
 		&models.UserPuzzle{},
 		&models.UserSolvedPuzzle{},
+		&models.Attempt{},
+		&models.PuzzleOpen{},
+		&models.UserHint{},
+		&models.RoomSession{},
+		&models.PuzzlePrerequisite{},
+		&models.Achievement{},
+		&models.UserAchievement{},
+		&models.DailyPuzzle{},
+		&models.ScoringConfig{},
+		&models.ReviewCard{},
+		&models.Review{},
+		&models.RefreshToken{},
+		&models.RevokedToken{},
+		&models.ActionToken{},
+		&models.ExportJob{},
 	)
 	if err != nil {
 		return err
 	}
 
-	// 2. Now seed data
+	// 2. One-time data migrations
+	if err := MigratePlaintextSolutions(db); err != nil {
+		return err
+	}
+	if err := MigrateStreakDays(db); err != nil {
+		return err
+	}
+
+	// 3. Now seed data
 	return SeedData(db)
 }
 
-// Available subjects to randomize from
-var availableSubjects = []string{"Physics", "Chemistry", "Biology", "Math", "Thai", "English", "Social"}
+// MigrateStreakDays fills streak_day_at for stats rows written before it was
+// split from last_solved_at, which used to track the streak day
+func MigrateStreakDays(db *gorm.DB) error {
+	if err := db.Model(&models.UserSolvedPuzzle{}).
+		Where("streak_day_at IS NULL").
+		Update("streak_day_at", gorm.Expr("last_solved_at")).Error; err != nil {
+		return fmt.Errorf("failed to backfill streak days: %w", err)
+	}
+	return nil
+}
+
+// MigratePlaintextSolutions converts puzzles created before solutions were
+// sealed. It reads the legacy plaintext "solution" column, stores the hash or
+// ciphertext instead, encrypts plaintext alternatives and drops the column.
+func MigratePlaintextSolutions(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&models.Puzzle{}, "solution") {
+		return nil
+	}
+
+	type legacyPuzzle struct {
+		ID           uint
+		Solution     string
+		MatchMode    string
+		Alternatives pq.StringArray `gorm:"type:text[]"`
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		var rows []legacyPuzzle
+		if err := tx.Table("puzzles").
+			Select("id", "solution", "match_mode", "alternatives").
+			Find(&rows).Error; err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			p := models.Puzzle{
+				ID:           row.ID,
+				Solution:     row.Solution,
+				MatchMode:    row.MatchMode,
+				Alternatives: row.Alternatives,
+			}
+			if err := puzzle.SealSolution(&p); err != nil {
+				return fmt.Errorf("puzzle %d: %w", row.ID, err)
+			}
+
+			if err := tx.Table("puzzles").Where("id = ?", row.ID).Updates(map[string]interface{}{
+				"solution_hash":   p.SolutionHash,
+				"solution_cipher": p.SolutionCipher,
+				"alternatives":    p.Alternatives,
+			}).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Migrator().DropColumn(&models.Puzzle{}, "solution")
+	})
+}
+
+// Available subjects to randomize from (copied because it is shuffled in place)
+var availableSubjects = append([]string(nil), models.Subjects...)
 
 func randomSubjects() pq.StringArray {
 	count := 3 // Number of subjects to pick
@@ -103,12 +192,26 @@ func SeedPuzzles(db *gorm.DB) error {
 		},
 	}
 
-	for _, puzzle := range puzzles {
-		if err := db.FirstOrCreate(&puzzle, models.Puzzle{ID: puzzle.ID}).Error; err != nil {
+	for _, p := range puzzles {
+		// Unscoped so a soft-deleted seed puzzle is not recreated with a clashing ID
+		var count int64
+		if err := db.Unscoped().Model(&models.Puzzle{}).Where("id = ?", p.ID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+
+		if err := puzzle.SealSolution(&p); err != nil {
+			return err
+		}
+		if err := db.Create(&p).Error; err != nil {
 			return err
 		}
 	}
-	return nil
+
+	// Seeds use explicit IDs, so move the sequence past them for admin-created puzzles
+	return db.Exec("SELECT setval(pg_get_serial_sequence('puzzles', 'id'), (SELECT MAX(id) FROM puzzles))").Error
 }
 
 func SeedUserPuzzles(db *gorm.DB) error {
@@ -172,7 +275,35 @@ func SeedUsers(db *gorm.DB) error {
 		return result.Error
 	}
 
-	return nil
+	return SeedAdmin(db)
+}
+
+// SeedAdmin creates the admin account when ADMIN_USERNAME and ADMIN_PASSWORD are set
+func SeedAdmin(db *gorm.DB) error {
+	username := os.Getenv("ADMIN_USERNAME")
+	password := os.Getenv("ADMIN_PASSWORD")
+	if username == "" || password == "" {
+		return nil
+	}
+
+	var count int64
+	if err := db.Model(&models.User{}).Where("username = ?", username).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		// Make sure an existing account keeps the admin role
+		return db.Model(&models.User{}).Where("username = ?", username).Update("role", models.RoleAdmin).Error
+	}
+
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	return db.Create(&models.User{
+		Username:     username,
+		PasswordHash: hash,
+		Role:         models.RoleAdmin,
+	}).Error
 }
 
 func SeedUserSolvedPuzzles(db *gorm.DB) error {
@@ -190,6 +321,7 @@ func SeedUserSolvedPuzzles(db *gorm.DB) error {
 		CurrentStreak: 4,
 		BestStreak:    4,
 		LastSolvedAt:  now.Add(-24 * time.Hour), // Matches last solve time
+		StreakDayAt:   now.Add(-24 * time.Hour), // The streak is still alive today
 	}
 
 	if err := db.Where(
@@ -202,6 +334,9 @@ func SeedUserSolvedPuzzles(db *gorm.DB) error {
 
 func SeedData(db *gorm.DB) error {
 	// Call all seed functions in order
+	if err := achievements.Sync(db); err != nil {
+		return err
+	}
 	if err := SeedPuzzles(db); err != nil {
 		return err
 	}